@@ -0,0 +1,83 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// The acid constants are the flags of an acid chunk.
+const (
+	acidOneShot  uint32 = 0x01
+	acidRootNote uint32 = 0x02
+	acidStretch  uint32 = 0x04
+)
+
+// AcidMetadata holds the fields of an acid chunk, which loop-based hosts such
+// as Acid and FL Studio read to time-stretch a loop to the tempo of a project.
+type AcidMetadata struct {
+	// Tempo is the tempo of the loop in beats per minute.
+	Tempo float64
+
+	// Beats is the length of the loop in beats.
+	Beats uint32
+
+	// RootNote is the MIDI note number of the key of the loop, e.g. 60 for
+	// middle C.  If it's 0, no root note is set and the loop isn't
+	// transposed.
+	RootNote uint8
+
+	// OneShot marks the file as a one-shot sample, which is played at its
+	// original speed instead of being stretched to the tempo.
+	OneShot bool
+
+	// MeterNumerator and MeterDenominator give the time signature.  If
+	// either is 0, 4/4 is written.
+	MeterNumerator   uint16
+	MeterDenominator uint16
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// encode returns the 24-byte body of the acid chunk.
+func (a *AcidMetadata) encode() ([]byte, error) {
+	if a.RootNote > 127 {
+		return nil, errors.New("The root note must be a MIDI note number from 0 to 127.")
+	}
+
+	if !a.OneShot && a.Tempo <= 0 {
+		return nil, errors.New("The tempo of a loop must be positive.")
+	}
+
+	var flags uint32
+	if a.OneShot {
+		flags |= acidOneShot
+	} else {
+		flags |= acidStretch
+	}
+	if a.RootNote != 0 {
+		flags |= acidRootNote
+	}
+
+	numerator, denominator := a.MeterNumerator, a.MeterDenominator
+	if numerator == 0 || denominator == 0 {
+		numerator, denominator = 4, 4
+	}
+
+	buffer := new(bytes.Buffer)
+
+	// Flags, root note, two fields that hosts write as 0x8000 and 0, the
+	// number of beats, the meter and the tempo.
+	fields := []any{flags, uint16(a.RootNote), uint16(0x8000), float32(0),
+		a.Beats, denominator, numerator, float32(a.Tempo)}
+	for _, field := range fields {
+		err := binary.Write(buffer, binary.LittleEndian, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
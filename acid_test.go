@@ -0,0 +1,44 @@
+package audioExport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAcidMetadataEncode(t *testing.T) {
+	acid := AcidMetadata{Tempo: 120, Beats: 8, RootNote: 60}
+
+	body, err := acid.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0x06, 0x00, 0x00, 0x00, // Flags: stretch and root note
+		0x3c, 0x00, // Root note
+		0x00, 0x80, // 0x8000
+		0x00, 0x00, 0x00, 0x00, // 0
+		0x08, 0x00, 0x00, 0x00, // Beats
+		0x04, 0x00, // Meter denominator
+		0x04, 0x00, // Meter numerator
+		0x00, 0x00, 0xf0, 0x42, // Tempo
+	}
+	if !bytes.Equal(body, want) {
+		t.Errorf("got % x, want % x", body, want)
+	}
+}
+
+func TestAcidMetadataEncodeErrors(t *testing.T) {
+	tests := []AcidMetadata{
+		{Tempo: 120, RootNote: 128},
+		{Tempo: 0},
+		{Tempo: -1},
+	}
+
+	for _, acid := range tests {
+		_, err := acid.encode()
+		if err == nil {
+			t.Errorf("%+v was encoded without an error", acid)
+		}
+	}
+}
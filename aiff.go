@@ -2,16 +2,99 @@ package audioExport
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"time"
 )
 
 // AiffFile is used to create uncompressed .aiff files.
 type AiffFile struct {
+	// AIFC writes an AIFF-C file, with a FORM type of AIFC, the mandatory FVER
+	// chunk and the extended common chunk that names the compression type.
+	// The samples are still uncompressed.  Plain AIFF is written by default.
+	// AIFC is required for descriptions with FormatIEEEFloat, which are
+	// written as big-endian floats with the fl32 or fl64 compression type.
+	AIFC bool
+
+	// FloatAIFC writes an AIFF-C file for descriptions with FormatIEEEFloat
+	// even if AIFC isn't set, while integer descriptions are still written as
+	// plain AIFF.  Without AIFC or FloatAIFC, opening a file with a float
+	// description returns an error rather than quantizing the samples.
+	FloatAIFC bool
+
+	// CheckExtension makes the Open methods fail if the extension of the file
+	// name doesn't match the format.  See Writer options in the package
+	// documentation.
+	CheckExtension bool
+
+	// TargetSampleRate, if set, is the sample rate written to the file.  The
+	// channels are buffered and resampled when the file is closed.  See Writer
+	// options in the package documentation.
+	TargetSampleRate uint32
+
+	// Limiter, if set, is applied to the buffered channels when the file is
+	// closed.  See Writer options in the package documentation.
+	Limiter *Limiter
+
+	// WriteSidecar makes Close write a JSON description of the file next to
+	// it, named after the file with .json appended.  See Writer options in the
+	// package documentation.
+	WriteSidecar bool
+
+	// ReferenceScale, if set, is the fraction of full scale that a sample of
+	// 1.0 is written at.  See Writer options in the package documentation.
+	ReferenceScale float64
+
+	// StrictClip makes writing fail with a *ClipError on the first sample
+	// outside the range -1.0 to 1.0.  See Writer options in the package
+	// documentation.
+	StrictClip bool
+
+	// OverviewBinSize, if set, is the number of frames in each bin of the
+	// waveform overview.  See Writer options in the package documentation.
+	OverviewBinSize int
+
+	// MeasureLoudness makes the file measure the integrated loudness of the
+	// samples, which IntegratedLoudness returns.  See Writer options in the
+	// package documentation.
+	MeasureLoudness bool
+
+	// Dither is the dither added to samples before they're quantized.  See
+	// Writer options in the package documentation.
+	Dither DitherMode
+
 	file         *os.File
+	name         string
 	description  AudioDescription
 	bytesWritten int32
+	closed       bool
+	preallocated bool
+	scratch      bytes.Buffer
+	pending      resampleBuffer
+	gains        []float64
+	levels       levelMeter
+	overview     overview
+	loudness     loudnessMeter
+	dither       *ditherer
+	headerSize   int32
+	commonOffset int32
+	trailerSize  int32
+	sizeKnown    bool
+	frameCount   uint64
+	knownTrailer int32
+	cues         []cuePoint
+	aifc         bool
+
+	aesChannelStatus []byte
+	instrument       *AiffInstrument
+	id3Tag           []byte
+	albumArt         []byte
+	monitor          io.Writer
 }
 
 // Open creates the file and writes the necessary headers.  The corresponding
@@ -19,66 +102,198 @@ type AiffFile struct {
 func (a *AiffFile) Open(fileName string, description AudioDescription) error {
 	var err error
 
+	err = a.reset(description)
+	if err != nil {
+		return err
+	}
+
+	if a.CheckExtension {
+		err = checkExtension(fileName, FileExtensions(FormatAiff)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.name = fileName
 	a.file, err = os.Create(fileName)
 	if err != nil {
 		return err
 	}
 
-	a.description = description
+	return a.start()
+}
 
-	buffer := new(bytes.Buffer)
-	err = a.writeHeader(buffer)
+// OpenWithFrameCount is like Open, but it takes the number of frames that
+// will be written, after any resampling.  The headers are written with their
+// final sizes, so they're never patched and the file can be written to a
+// destination that can't seek, such as a named pipe.  Any AES channel status,
+// ID3 tag or album art must be set beforehand.  Close returns an error if a
+// different number of frames was written.
+func (a *AiffFile) OpenWithFrameCount(fileName string, description AudioDescription, frames uint64) error {
+	var err error
+
+	err = a.reset(description)
 	if err != nil {
 		return err
 	}
 
-	_, err = a.file.Write(buffer.Bytes())
-	return err
+	if a.CheckExtension {
+		err = checkExtension(fileName, FileExtensions(FormatAiff)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if frames*uint64(a.frameSize()) > uint64(MaxFileSize(FormatAiff)) {
+		return errors.New("The frame count is too large for an .aiff file.")
+	}
+
+	a.knownTrailer, err = a.trailerLength()
+	if err != nil {
+		return err
+	}
+	a.sizeKnown = true
+	a.frameCount = frames
+
+	a.name = fileName
+	a.file, err = os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	return a.start()
+}
+
+// OpenContext is like Open, but it stops waiting for the file to be created
+// when the context is done, returning ctx.Err().  This bounds how long Open
+// can hang on a slow filesystem.  If the file is created after the context
+// is done, it's closed and removed.
+func (a *AiffFile) OpenContext(ctx context.Context, fileName string, description AudioDescription) error {
+	var err error
+
+	err = a.reset(description)
+	if err != nil {
+		return err
+	}
+
+	if a.CheckExtension {
+		err = checkExtension(fileName, FileExtensions(FormatAiff)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.name = fileName
+	a.file, err = createContext(ctx, fileName)
+	if err != nil {
+		return err
+	}
+
+	return a.start()
 }
 
 // WriteBytes writes the binary waveform to the file.  It expects muxed data
 // in the format specified by the audio description.  In most cases,
 // WriteChannels is more suitable because it will convert and mux the data for
 // you.  WriteBytes can be called several times, so long as the file doesn't
-// reach its 4GB limit.
+// reach its 2GB limit.  It returns ErrClosed if the file isn't open and a
+// *ShortWriteError if the data couldn't be written in full.
 func (a *AiffFile) WriteBytes(bytes []byte) error {
-	n, err := a.file.Write(bytes)
-	a.bytesWritten += int32(n)
-	return err
+	if a.closed || a.file == nil {
+		return ErrClosed
+	}
+
+	if a.buffering() {
+		return errors.New("Raw bytes can't be resampled or limited; use WriteChannels instead.")
+	}
+
+	return a.writeData(bytes)
+}
+
+// DataWriter returns the data chunk as an io.WriteCloser, for use with io.Copy
+// and other code that expects a writer.  Write adds raw bytes to the data
+// chunk like WriteBytes, so a write that would take the file beyond its 2GB
+// limit fails without writing anything, and Close closes the file like Close.
+func (a *AiffFile) DataWriter() io.WriteCloser {
+	return dataWriter{writeBytes: a.WriteBytes, close: a.Close}
 }
 
 // WriteChannels muxes and writes the channels to the file.  Each channel
 // should be a float64 slice where each item in the array ranges from -1 to 1.
 // Any values beyond these bounds will be automatically clipped.  WriteChannels
-// can be called several times, so long as the file doesn't reach its 4GB
-// limit.
+// can be called several times, so long as the file doesn't reach its 2GB
+// limit.  If every channel is empty, nothing is written; closing the file
+// afterwards still produces a valid file, with no audio data if none was
+// written before.
 func (a *AiffFile) WriteChannels(channels ...[]float64) error {
 	var err error
 
-	// If too many channels are given, return an error.
-	if len(channels) != int(a.description.NumChannels) {
-		return errors.New("The number of audio channels doesn't equal the number of streams supplied.")
+	err = checkChannels(a.description, channels)
+	if err != nil {
+		return err
 	}
 
-	// Make sure the data streams are all of the same length
-	var chanLength int = -1
-	for i := range channels {
-		if chanLength == -1 {
-			chanLength = len(channels[i])
-			continue
+	// When resampling or limiting, the channels are buffered until Close.
+	if a.buffering() {
+		if a.closed || a.file == nil {
+			return ErrClosed
 		}
 
-		if len(channels[i]) != chanLength {
-			return errors.New("The channels have different amounts of audio data.")
-		}
+		a.pending.append(channels)
+		return nil
+	}
+
+	if isStereo16(a.description) && !a.inspectsSamples() {
+		return a.WriteBytes(encodeStereo16(channels[0], channels[1], binary.BigEndian))
+	}
+
+	data, err := encodeChannels(channels, a.writeSampleToBuffer)
+	if err != nil {
+		return err
+	}
+
+	return a.WriteBytes(data)
+}
+
+// WriteComplex writes complex samples, such as the I/Q data of a software
+// defined radio, to a stereo file.  The real part (I) of each sample is
+// written to channel 0 and the imaginary part (Q) to channel 1.  The file
+// must have been opened with 2 channels.
+func (a *AiffFile) WriteComplex(samples []complex128) error {
+	return writeComplex(a, samples)
+}
+
+// WriteChannels2D is like WriteChannels, but it takes the channels as a single
+// slice, which suits code with a dynamic number of channels.
+func (a *AiffFile) WriteChannels2D(channels [][]float64) error {
+	return a.WriteChannels(channels...)
+}
+
+// WriteChannelsInt32 muxes and writes integer channels to the file without
+// converting them to floats.  The samples are treated as left-justified, so a
+// full-scale sample spans the entire int32 range.  This is how most hardware
+// delivers 24-bit data in 32-bit containers.  For 24-bit files, the most
+// significant 24 bits of each sample are written and the low byte is
+// discarded.  WriteChannelsInt32 is only supported for 24- and 32-bit files.
+func (a *AiffFile) WriteChannelsInt32(channels ...[]int32) error {
+	var err error
+
+	bits := a.description.containerBits()
+	if a.description.isFloat() || (bits != BPS24 && bits != BPS32) {
+		return errors.New("Integer channels can only be written to 24- or 32-bit files.")
+	}
+
+	err = checkChannels(a.description, channels)
+	if err != nil {
+		return err
 	}
 
 	buffer := new(bytes.Buffer)
 
 	// Write to the buffer
-	for i := 0; i < chanLength; i++ {
+	for i := 0; i < len(channels[0]); i++ {
 		for j := range channels {
-			err = a.writeFloatToBuffer(channels[j][i], buffer)
+			err = encodeInt32(channels[j][i], a.description, binary.BigEndian, buffer)
 			if err != nil {
 				return err
 			}
@@ -88,33 +303,384 @@ func (a *AiffFile) WriteChannels(channels ...[]float64) error {
 	return a.WriteBytes(buffer.Bytes())
 }
 
+// WriteFrame writes a single frame, taking one sample per channel.  It's the
+// per-frame complement to WriteChannels and reuses an internal buffer, so it
+// doesn't allocate on each call.
+func (a *AiffFile) WriteFrame(sample ...float64) error {
+	var err error
+
+	// If too many samples are given, return an error.
+	if len(sample) != int(a.description.NumChannels) {
+		return &ChannelCountError{Expected: int(a.description.NumChannels), Actual: len(sample)}
+	}
+
+	// When resampling or limiting, the frame is buffered until Close.
+	if a.buffering() {
+		if a.closed || a.file == nil {
+			return ErrClosed
+		}
+
+		a.pending.appendFrame(sample)
+		return nil
+	}
+
+	a.scratch.Reset()
+	for i := range sample {
+		err = a.writeSampleToBuffer(sample[i], i, 0, &a.scratch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.WriteBytes(a.scratch.Bytes())
+}
+
+// WriteSilence writes the number of frames of silence corresponding to the
+// given duration at the description's sample rate.
+func (a *AiffFile) WriteSilence(d time.Duration) error {
+	return writeSilence(a, a.description.DurationToFrame(d))
+}
+
 // Close completes the headers and closes the file.  Close should always be
 // called when you're done writing data.
 func (a *AiffFile) Close() error {
 	var err error
 
-	err = a.closeDataChunk()
+	if a.closed || a.file == nil {
+		return ErrClosed
+	}
+
+	// A failed flush can't be retried, so the file is closed regardless.
+	if a.buffering() {
+		err = a.flushPending()
+		if err != nil {
+			a.closed = true
+			a.file.Close()
+			return err
+		}
+	}
+	a.closed = true
+
+	if !a.sizeKnown {
+		err = a.closeDataChunk()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = a.writeTrailingChunks()
+	if err != nil {
+		return err
+	}
+
+	if !a.sizeKnown {
+		err = a.closeCommonChunk()
+		if err != nil {
+			return err
+		}
+
+		err = a.closeContainerChunk()
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.preallocated {
+		err = truncateToPosition(a.file)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = a.file.Close()
+	if err != nil {
+		return err
+	}
+
+	if a.WriteSidecar {
+		err = a.writeSidecar()
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.checkFrameCount()
+}
+
+// CloseInfo is like Close, but it also returns the path of the finished file
+// and its size in bytes, which is convenient for logging.
+func (a *AiffFile) CloseInfo() (string, int64, error) {
+	err := a.Close()
+	if err != nil {
+		return "", 0, err
+	}
+
+	return fileInfo(a.name)
+}
+
+// Preallocate extends the file to the size it will have once the given number
+// of frames has been written, which avoids fragmentation on some filesystems.
+// The data written afterwards fills the reserved space, and Close truncates the
+// file if fewer frames were written.  It must be called after Open, and it
+// returns an error if more frames have already been written.
+func (a *AiffFile) Preallocate(frames uint64) error {
+	if a.closed || a.file == nil {
+		return ErrClosed
+	}
+
+	if frames < uint64(a.bytesWritten)/uint64(a.frameSize()) {
+		return errors.New("Fewer frames can't be preallocated than have already been written.")
+	}
+
+	size, err := preallocatedSize(FormatAiff, a.description, int64(a.headerSize), frames)
 	if err != nil {
 		return err
 	}
 
-	err = a.closeCommonChunk()
+	err = a.file.Truncate(size)
 	if err != nil {
 		return err
 	}
 
-	err = a.closeContainerChunk()
+	a.preallocated = true
+	return nil
+}
+
+// PatchHeader overwrites part of the headers that precede the sample data,
+// such as to inject a field written by another application.  The write must
+// lie entirely within the headers, so it can't overwrite samples.  The chunk
+// sizes and frame counts are still rewritten by Close.
+func (a *AiffFile) PatchHeader(offset int64, data []byte) error {
+	if a.closed || a.file == nil {
+		return ErrClosed
+	}
+
+	if offset < 0 || offset+int64(len(data)) > int64(a.headerSize) {
+		return errors.New("The patch extends beyond the header.")
+	}
+
+	_, err := a.file.WriteAt(data, offset)
+	return err
+}
+
+// AudioDescription acts as a getter for the AudioDescription provided to the
+// Open method.
+func (a *AiffFile) AudioDescription() AudioDescription {
+	return a.description
+}
+
+// IntegratedLoudness returns the integrated loudness in LUFS of the samples
+// written so far, measured when MeasureLoudness is set.  It returns NaN if the
+// loudness wasn't measured and negative infinity if the file is silent or
+// shorter than 400ms.
+func (a *AiffFile) IntegratedLoudness() float64 {
+	if !a.MeasureLoudness {
+		return math.NaN()
+	}
+	return a.loudness.integrated()
+}
+
+// WaveformOverview returns the overview recorded with OverviewBinSize, with
+// the minimum and maximum of each channel over every binSize frames.  binSize
+// must be a multiple of OverviewBinSize, which lets several zoom levels be
+// drawn from one recording.  The last bin may cover fewer frames.  It returns
+// nil if no overview was recorded or binSize isn't a multiple.
+func (a *AiffFile) WaveformOverview(binSize int) [][]MinMax {
+	return a.overview.merge(binSize)
+}
+
+// SetInstrument sets the fields of an INST chunk, which maps the file onto the
+// keys and velocities of a sampler and can loop it between markers added with
+// AddCue.  It's written when the file is closed, when every marker that a
+// loop refers to must have been added.
+func (a *AiffFile) SetInstrument(inst *AiffInstrument) error {
+	res, err := inst.normalize()
+	if err != nil {
+		return err
+	}
+
+	a.instrument = &res
+	return nil
+}
+
+// SetAESChannelStatus sets the 24 bytes of AES3 channel status data, which
+// carry flags such as emphasis and copyright.  They're written to an AESD
+// chunk when the file is closed.
+func (a *AiffFile) SetAESChannelStatus(status []byte) error {
+	if len(status) != 24 {
+		return errors.New("The AES channel status must be 24 bytes long.")
+	}
+
+	a.aesChannelStatus = append([]byte(nil), status...)
+	return nil
+}
+
+// SetID3 sets an ID3v2 tag, which is written to an ID3 chunk when the file is
+// closed.  Players such as Apple Music read their title and artist metadata
+// from it.  The tag must be complete, starting with its 10-byte header.
+func (a *AiffFile) SetID3(tag []byte) error {
+	if len(tag) < 10 || string(tag[0:3]) != "ID3" {
+		return errors.New("The ID3 tag must start with an ID3v2 header.")
+	}
+
+	_, err := buildID3(tag, a.albumArt)
+	if err != nil {
+		return err
+	}
+
+	a.id3Tag = append([]byte(nil), tag...)
+	return nil
+}
+
+// SetAlbumArt sets a JPEG or PNG image to embed as the front cover, in an
+// APIC frame of the ID3 chunk.  The frame is added to any tag given to SetID3,
+// or to a new ID3v2.3 tag.  The image can't be larger than MaxAlbumArtSize.
+func (a *AiffFile) SetAlbumArt(image []byte) error {
+	err := validateAlbumArt(image)
+	if err != nil {
+		return err
+	}
+
+	_, err = buildID3(a.id3Tag, image)
+	if err != nil {
+		return err
+	}
+
+	a.albumArt = append([]byte(nil), image...)
+	return nil
+}
+
+// SetChannelGains sets a linear gain for each channel, such as to trim the
+// LFE channel, which is applied to every sample given to WriteChannels or
+// WriteFrame before it's clamped.  It multiplies with any gain already applied
+// to the samples, e.g. one from DBToLinear.  The number of gains must equal
+// the number of channels, so it must be called after Open, and the gains are
+// cleared when the file is opened again.
+func (a *AiffFile) SetChannelGains(gains []float64) error {
+	if len(gains) != int(a.description.NumChannels) {
+		return errors.New("The number of gains doesn't equal the number of audio channels.")
+	}
+
+	a.gains = append([]float64(nil), gains...)
+	return nil
+}
+
+// SetMonitor sets a writer, such as a ring buffer feeding a live output, that
+// receives a copy of the muxed sample data as it's written to the file.  The
+// monitor must not block.  Its errors are ignored so that monitoring can't
+// interrupt the recording.  A nil writer removes the monitor.
+func (a *AiffFile) SetMonitor(monitor io.Writer) {
+	a.monitor = monitor
+}
+
+// AddCue adds a marker at the given frame, counted from the start of the
+// file, with an optional label of up to 255 bytes.  The markers are written
+// to a MARK chunk when the file is closed.  It must be called after Open, and
+// the markers are cleared when the file is opened again.  Markers can't be
+// added with OpenWithFrameCount, since the chunk follows the data.
+func (a *AiffFile) AddCue(frame uint64, label string) error {
+	if a.closed || a.file == nil {
+		return ErrClosed
+	}
+
+	if a.sizeKnown {
+		return errors.New("Cue points can't be added when the sizes are written up front.")
+	}
+
+	if len(label) > 255 {
+		return errors.New("The marker label is longer than 255 bytes.")
+	}
+
+	if len(a.cues) == math.MaxInt16 {
+		return errors.New("An AIFF file can't hold any more markers.")
+	}
+
+	cue, err := newCuePoint(frame, label)
 	if err != nil {
 		return err
 	}
 
-	return a.file.Close()
+	a.cues = append(a.cues, cue)
+	return nil
+}
+
+// AddCueAt is like AddCue, but it takes the time of the marker, which is
+// rounded to the nearest frame at the description's sample rate.
+func (a *AiffFile) AddCueAt(t time.Duration, label string) error {
+	return a.AddCue(a.description.DurationToFrame(t), label)
 }
 
 /*****************************************************************************/
 /****************************** Private Methods ******************************/
 /*****************************************************************************/
 
+// reset prepares the file to be opened with the given description, returning
+// an error if the options and description can't be combined.
+func (a *AiffFile) reset(description AudioDescription) error {
+	if description.NumChannels <= 0 {
+		return errors.New("The description must have at least one channel.")
+	}
+
+	a.description = description
+	a.closed = false
+	a.preallocated = false
+	a.bytesWritten = 0
+	a.pending.reset(description.NumChannels)
+	a.gains = nil
+	a.levels = levelMeter{}
+	a.overview.reset(description.NumChannels, a.OverviewBinSize)
+	a.loudness.reset(0, 0)
+	dither, err := newWriterDitherer(a.Dither, description, false)
+	if err != nil {
+		return err
+	}
+	a.dither = dither
+	if a.MeasureLoudness {
+		a.loudness.reset(description.NumChannels, a.outputSampleRate())
+	}
+	a.trailerSize = 0
+	a.sizeKnown = false
+	a.cues = nil
+	a.aifc = a.AIFC || (a.FloatAIFC && description.isFloat())
+
+	if description.isFloat() && !a.aifc {
+		return errors.New("Floating-point samples can only be written to AIFC files; set AIFC or FloatAIFC.")
+	}
+
+	if description.isFloat() && description.containerBits() != BPS32 && description.containerBits() != BPS64 {
+		return errors.New("Floating-point samples must be 32 or 64 bits.")
+	}
+
+	if a.Dither < DitherNone || a.Dither > DitherNoiseShaped {
+		return errors.New("Invalid dither mode.")
+	}
+
+	if a.OverviewBinSize < 0 {
+		return errors.New("OverviewBinSize can't be negative.")
+	}
+
+	return nil
+}
+
+// start writes the headers to the newly created file.
+func (a *AiffFile) start() error {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	err = a.writeHeader(buffer)
+	if err != nil {
+		return err
+	}
+	a.headerSize = int32(buffer.Len())
+
+	if a.sizeKnown {
+		a.fillSizes(buffer.Bytes(), uint32(a.frameCount)*uint32(a.frameSize()), uint32(a.knownTrailer))
+	}
+
+	_, err = a.file.Write(buffer.Bytes())
+	return err
+}
+
 // writeHeader writes the header chunks to the buffer.
 func (a *AiffFile) writeHeader(buffer *bytes.Buffer) error {
 	var err error
@@ -124,6 +690,16 @@ func (a *AiffFile) writeHeader(buffer *bytes.Buffer) error {
 		return err
 	}
 
+	// The FVER chunk is mandatory in AIFF-C files and must not appear in
+	// plain AIFF files.
+	if a.aifc {
+		err = a.writeVersionChunk(buffer)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.commonOffset = int32(buffer.Len())
 	err = a.writeCommonChunk(buffer)
 	if err != nil {
 		return err
@@ -150,11 +726,37 @@ func (a *AiffFile) writeContainerChunk(buffer *bytes.Buffer) error {
 		return err
 	}
 
-	// Format (WAVE)
+	// Format (AIFF or AIFC)
+	if a.aifc {
+		_, err = buffer.WriteString("AIFC")
+		return err
+	}
+
 	_, err = buffer.WriteString("AIFF")
 	return err
 }
 
+// writeVersionChunk writes the format version chunk of an AIFF-C file to the
+// buffer.
+func (a *AiffFile) writeVersionChunk(buffer *bytes.Buffer) error {
+	var err error
+
+	// Chunk ID (FVER)
+	_, err = buffer.WriteString("FVER")
+	if err != nil {
+		return err
+	}
+
+	// Chunk size (always 4)
+	err = binary.Write(buffer, binary.BigEndian, int32(4))
+	if err != nil {
+		return err
+	}
+
+	// Timestamp of AIFF-C version 1
+	return binary.Write(buffer, binary.BigEndian, uint32(0xA2805140))
+}
+
 // writeCommonChunk writes the mandatory common chunk to the buffer.
 func (a *AiffFile) writeCommonChunk(buffer *bytes.Buffer) error {
 	var err error
@@ -165,8 +767,13 @@ func (a *AiffFile) writeCommonChunk(buffer *bytes.Buffer) error {
 		return err
 	}
 
-	// Chunk size (always 18)
-	err = binary.Write(buffer, binary.BigEndian, int32(18))
+	// Chunk size (18 for AIFF, or 22 plus the compression name for AIFF-C)
+	compressionType, compressionName := a.compression()
+	var chunkSize int32 = 18
+	if a.aifc {
+		chunkSize = 22 + int32(len(compressionName))
+	}
+	err = binary.Write(buffer, binary.BigEndian, chunkSize)
 	if err != nil {
 		return err
 	}
@@ -183,8 +790,8 @@ func (a *AiffFile) writeCommonChunk(buffer *bytes.Buffer) error {
 		return err
 	}
 
-	// Bits per sample
-	err = binary.Write(buffer, binary.BigEndian, a.description.BitsPerSample)
+	// Bits per sample (the unused low bits of each container are zero)
+	err = binary.Write(buffer, binary.BigEndian, a.description.validBits())
 	if err != nil {
 		return err
 	}
@@ -199,9 +806,45 @@ func (a *AiffFile) writeCommonChunk(buffer *bytes.Buffer) error {
 		return err
 	}
 
+	// Compression type and name
+	if a.aifc {
+		_, err = buffer.WriteString(compressionType)
+		if err != nil {
+			return err
+		}
+
+		_, err = buffer.Write(compressionName)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// compression returns the compression type of an AIFF-C file and its name as
+// a Pascal string padded to an even length.
+func (a *AiffFile) compression() (string, []byte) {
+	if a.description.isFloat() {
+		if a.description.containerBits() == BPS64 {
+			return "fl64", pascalString("Float 64-bit")
+		}
+		return "fl32", pascalString("Float 32-bit")
+	}
+
+	return "NONE", pascalString("not compressed")
+}
+
+// pascalString encodes s as a count byte followed by the characters, padded
+// to an even length.
+func pascalString(s string) []byte {
+	res := append([]byte{byte(len(s))}, s...)
+	if len(res)%2 == 1 {
+		res = append(res, 0)
+	}
+	return res
+}
+
 // startDataChunk writes the start of the data chunk to the buffer.
 func (a *AiffFile) startDataChunk(buffer *bytes.Buffer) error {
 	var err error
@@ -243,8 +886,9 @@ func (a *AiffFile) closeDataChunk() error {
 		return err
 	}
 
-	// The offset of the size of the data chunk is always 42 bytes.
-	_, err = a.file.WriteAt(buffer.Bytes(), 42)
+	// The size of the data chunk is followed by the offset and block size,
+	// which end the header.
+	_, err = a.file.WriteAt(buffer.Bytes(), int64(a.headerSize)-12)
 	if err != nil {
 		return err
 	}
@@ -252,11 +896,190 @@ func (a *AiffFile) closeDataChunk() error {
 	return nil
 }
 
+// writeTrailingChunks writes the optional chunks that follow the sound data.
+func (a *AiffFile) writeTrailingChunks() error {
+	var err error
+
+	// The sound data must be padded to an even number of bytes before any
+	// other chunk can follow it.
+	if a.paddedDataSize() != a.bytesWritten {
+		_, err = a.file.Write([]byte{0})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(a.cues) != 0 {
+		marks, err := encodeAiffMarkers(a.cues)
+		if err != nil {
+			return err
+		}
+
+		err = a.writeChunk("MARK", marks)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.instrument != nil {
+		inst, err := a.instrument.encode(len(a.cues))
+		if err != nil {
+			return err
+		}
+
+		err = a.writeChunk("INST", inst)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.aesChannelStatus != nil {
+		err = a.writeChunk("AESD", a.aesChannelStatus)
+		if err != nil {
+			return err
+		}
+	}
+
+	tag, err := buildID3(a.id3Tag, a.albumArt)
+	if err != nil {
+		return err
+	}
+
+	if tag != nil {
+		err = a.writeChunk("ID3 ", tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trailerLength returns the number of bytes that writeTrailingChunks will
+// write after the padded sound data.
+func (a *AiffFile) trailerLength() (int32, error) {
+	var size int32
+
+	if len(a.cues) != 0 {
+		marks, err := encodeAiffMarkers(a.cues)
+		if err != nil {
+			return 0, err
+		}
+		size += 8 + int32(len(marks)+len(marks)%2)
+	}
+
+	if a.instrument != nil {
+		size += 8 + 20
+	}
+
+	if a.aesChannelStatus != nil {
+		size += 8 + int32(len(a.aesChannelStatus))
+	}
+
+	tag, err := buildID3(a.id3Tag, a.albumArt)
+	if err != nil {
+		return 0, err
+	}
+
+	if tag != nil {
+		size += 8 + int32(len(tag)+len(tag)%2)
+	}
+
+	return size, nil
+}
+
+// writeChunk writes a complete chunk at the end of the file, padding it to an
+// even number of bytes.
+func (a *AiffFile) writeChunk(id string, body []byte) error {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(id)
+
+	err = binary.Write(buffer, binary.BigEndian, int32(len(body)))
+	if err != nil {
+		return err
+	}
+
+	buffer.Write(body)
+	if len(body)%2 == 1 {
+		buffer.WriteByte(0)
+	}
+
+	n, err := a.file.Write(buffer.Bytes())
+	a.trailerSize += int32(n)
+	return err
+}
+
+// fillSizes writes the final chunk sizes and frame count for dataSize bytes of
+// sound data into a header built by writeHeader.  trailerSize is the number of
+// bytes of the chunks that follow the padded sound data.
+func (a *AiffFile) fillSizes(header []byte, dataSize, trailerSize uint32) {
+	var numSampleFrames uint32
+	if a.frameSize() > 0 {
+		numSampleFrames = dataSize / uint32(a.frameSize())
+	}
+
+	binary.BigEndian.PutUint32(header[4:], uint32(len(header))-8+dataSize+dataSize%2+trailerSize)
+	binary.BigEndian.PutUint32(header[a.commonOffset+10:], numSampleFrames)
+	binary.BigEndian.PutUint32(header[len(header)-12:], dataSize+8)
+}
+
+// checkFrameCount returns an error if the file was opened with
+// OpenWithFrameCount and the data or trailing chunks don't match the sizes
+// declared in the header.
+func (a *AiffFile) checkFrameCount() error {
+	if !a.sizeKnown {
+		return nil
+	}
+
+	if uint64(a.bytesWritten) != a.frameCount*uint64(a.frameSize()) {
+		return fmt.Errorf("%d frames were written, but the header declares %d.", a.bytesWritten/a.frameSize(), a.frameCount)
+	}
+
+	if a.trailerSize != a.knownTrailer {
+		return errors.New("The metadata chunks were changed after OpenWithFrameCount.")
+	}
+
+	return nil
+}
+
+// frameSize returns the number of bytes in a frame of audio.
+func (a *AiffFile) frameSize() int32 {
+	return int32(a.description.NumChannels) * int32(a.description.containerBits()) / 8
+}
+
+// writeData writes bytes to the sound data chunk, keeping count of them and
+// copying them to the monitor.
+func (a *AiffFile) writeData(data []byte) error {
+	if int64(a.headerSize)+int64(a.bytesWritten)+int64(len(data)) > MaxFileSize(FormatAiff) {
+		return errors.New("The data would exceed the maximum size of an .aiff file.")
+	}
+
+	n, err := a.file.Write(data)
+	a.bytesWritten += int32(n)
+
+	if a.monitor != nil {
+		a.monitor.Write(data[:n])
+	}
+
+	return shortWrite(n, len(data), err)
+}
+
+// paddedDataSize returns the number of bytes of sound data, including the pad
+// byte that follows an odd amount of data.
+func (a *AiffFile) paddedDataSize() int32 {
+	return a.bytesWritten + a.bytesWritten%2
+}
+
 // closeCommonChunk writes the number of sample frames to the common chunk.
 func (a *AiffFile) closeCommonChunk() error {
 	var err error
 
-	numSampleFrames := uint32(a.bytesWritten / int32(a.description.BitsPerSample))
+	var numSampleFrames uint32
+	if a.frameSize() > 0 {
+		numSampleFrames = uint32(a.bytesWritten / a.frameSize())
+	}
 
 	buffer := new(bytes.Buffer)
 	err = binary.Write(buffer, binary.BigEndian, numSampleFrames)
@@ -264,7 +1087,8 @@ func (a *AiffFile) closeCommonChunk() error {
 		return err
 	}
 
-	_, err = a.file.WriteAt(buffer.Bytes(), 22)
+	// The frame count follows the chunk header and the number of channels.
+	_, err = a.file.WriteAt(buffer.Bytes(), int64(a.commonOffset)+10)
 	if err != nil {
 		return err
 	}
@@ -277,7 +1101,7 @@ func (a *AiffFile) closeContainerChunk() error {
 	var err error
 
 	buffer := new(bytes.Buffer)
-	err = binary.Write(buffer, binary.BigEndian, a.bytesWritten+46)
+	err = binary.Write(buffer, binary.BigEndian, a.headerSize-8+a.paddedDataSize()+a.trailerSize)
 	if err != nil {
 		return err
 	}
@@ -291,55 +1115,156 @@ func (a *AiffFile) closeContainerChunk() error {
 	return nil
 }
 
-// writeFloatToBuffer determines which method to call in order to write the
-// data to the buffer at the right bit depth.
-func (a *AiffFile) writeFloatToBuffer(data float64, buffer *bytes.Buffer) error {
-	switch a.description.BitsPerSample {
-	case BPS8:
-		return a.write8BitToBuffer(data, buffer)
-	case BPS16:
-		return a.write16BitToBuffer(data, buffer)
-	case BPS32:
-		return a.write32BitToBuffer(data, buffer)
-	default:
-		return errors.New("Invalid bit depth")
+// resampling returns whether the data is resampled when the file is closed.
+func (a *AiffFile) resampling() bool {
+	return a.TargetSampleRate != 0 && a.TargetSampleRate != a.description.SampleRate
+}
+
+// outputSampleRate returns the sample rate written to the file.
+func (a *AiffFile) outputSampleRate() uint32 {
+	if a.TargetSampleRate != 0 {
+		return a.TargetSampleRate
 	}
+	return a.description.SampleRate
+}
+
+// buffering returns whether the channels are buffered until the file is
+// closed, to be resampled or limited.
+func (a *AiffFile) buffering() bool {
+	return a.resampling() || a.Limiter != nil
+}
+
+// flushPending resamples and limits the buffered channels as needed and writes
+// them to the file in blocks.
+func (a *AiffFile) flushPending() error {
+	var err error
+
+	var channels [][]float64
+	if a.resampling() {
+		channels = a.pending.resample(a.description.SampleRate, a.TargetSampleRate)
+	} else {
+		channels = a.pending.take()
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+
+	if a.Limiter != nil {
+		a.Limiter.Apply(channels, a.outputSampleRate())
+	}
+
+	buffer := new(bytes.Buffer)
+	for start := 0; start < len(channels[0]); start += silenceBlockSize {
+		end := start + silenceBlockSize
+		if end > len(channels[0]) {
+			end = len(channels[0])
+		}
+
+		buffer.Reset()
+		for i := start; i < end; i++ {
+			for j := range channels {
+				err = a.writeSampleToBuffer(channels[j][i], j, i-start, buffer)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = a.writeData(buffer.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// write8BitToBuffer writes an 8-bit unsigned integer to the buffer.
-func (a *AiffFile) write8BitToBuffer(data float64, buffer *bytes.Buffer) error {
-	res := uint8(data*127 + 127)
-	return binary.Write(buffer, binary.BigEndian, res)
+// writeSidecar writes the JSON sidecar describing the closed file.
+func (a *AiffFile) writeSidecar() error {
+	desc := a.description
+	if a.TargetSampleRate != 0 {
+		desc = NewAudioDescription(desc.NumChannels, float64(a.TargetSampleRate), desc.BitsPerSample)
+		desc.ContainerBits = a.description.ContainerBits
+		desc.Format = a.description.Format
+	}
+
+	var frames uint64
+	if a.frameSize() > 0 {
+		frames = uint64(a.bytesWritten / a.frameSize())
+	}
+
+	return writeSidecar(a.name, desc, frames, &a.levels)
+}
+
+// inspectsSamples returns whether any option needs to see each sample given
+// as a float, which rules out the fast path for 16-bit stereo.
+func (a *AiffFile) inspectsSamples() bool {
+	return a.gains != nil || a.ReferenceScale != 0 || a.StrictClip || a.WriteSidecar ||
+		a.OverviewBinSize != 0 || a.MeasureLoudness || a.Dither != DitherNone
+}
+
+// gain returns the gain of the given channel.
+func (a *AiffFile) gain(channel int) float64 {
+	if a.gains == nil {
+		return 1
+	}
+	return a.gains[channel]
 }
 
-// write16BitToBuffer writes a 16-bit integer to the buffer.
-func (a *AiffFile) write16BitToBuffer(data float64, buffer *bytes.Buffer) error {
-	res := int16(data * 32767)
-	return binary.Write(buffer, binary.BigEndian, res)
+// writeSampleToBuffer applies the channel gain and reference scale to a sample
+// and writes it to the buffer, checking for clipping if StrictClip is set.
+// frame is the index of the sample's frame relative to the frames already in
+// the file.
+func (a *AiffFile) writeSampleToBuffer(data float64, channel, frame int, buffer *bytes.Buffer) error {
+	data *= a.gain(channel)
+	if a.ReferenceScale != 0 {
+		data *= a.ReferenceScale
+	}
+
+	if a.StrictClip && !(math.Abs(data) <= 1) {
+		var written uint64
+		if a.frameSize() > 0 {
+			written = uint64(a.bytesWritten / a.frameSize())
+		}
+		return &ClipError{Channel: channel, Frame: written + uint64(frame), Value: data}
+	}
+
+	a.overview.add(data, channel)
+	a.loudness.add(data, channel)
+	if a.WriteSidecar {
+		a.levels.add(data)
+	}
+
+	if a.dither != nil {
+		data = a.dither.process(data, channel)
+	}
+	return a.writeFloatToBuffer(data, buffer)
 }
 
-// write32BitToBuffer writes a 32-bit integer to the buffer.
-func (a *AiffFile) write32BitToBuffer(data float64, buffer *bytes.Buffer) error {
-	res := int32(data * 2147483647)
-	return binary.Write(buffer, binary.BigEndian, res)
+// writeFloatToBuffer writes the sample to the buffer at the right bit depth.
+func (a *AiffFile) writeFloatToBuffer(data float64, buffer *bytes.Buffer) error {
+	return encodeSample(data, a.description, binary.BigEndian, true, buffer)
 }
 
-// convertSampleRate generates the 80-bit byte slice corresponding to the
-// selected sample rate.
+// convertSampleRate generates the 80-bit IEEE extended precision float
+// corresponding to the selected sample rate.
 func (a *AiffFile) convertSampleRate() ([]byte, error) {
-	switch a.description.SampleRate {
-	case SampleRate32k:
-		return []byte{64, 13, 250, 0, 0, 0, 0, 0, 0, 0}, nil
-	case SampleRate44_1k:
-		return []byte{64, 14, 172, 68, 0, 0, 0, 0, 0, 0}, nil
-	case SampleRate48k:
-		return []byte{64, 14, 187, 128, 0, 0, 0, 0, 0, 0}, nil
-	case SampleRate96k:
-		return []byte{64, 15, 187, 128, 0, 0, 0, 0, 0, 0}, nil
-	case SampleRate192k:
-		return []byte{64, 16, 187, 128, 0, 0, 0, 0, 0, 0}, nil
-	default:
+	rate := a.description.sampleRate()
+	if a.TargetSampleRate != 0 {
+		rate = float64(a.TargetSampleRate)
+	}
+	if !(rate > 0) || math.IsInf(rate, 0) {
 		return nil, errors.New("Invalid sample rate")
 	}
+
+	// The extended format stores the exponent with a bias of 16383 followed
+	// by a 64-bit mantissa whose integer bit is explicit.
+	frac, exp := math.Frexp(rate)
+	exponent := uint16(exp - 1 + 16383)
+	mantissa := uint64(math.Ldexp(frac, 64))
+
+	res := make([]byte, 10)
+	binary.BigEndian.PutUint16(res[0:2], exponent)
+	binary.BigEndian.PutUint64(res[2:10], mantissa)
+	return res, nil
 }
@@ -0,0 +1,239 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestAiff opens a new .aiff file in a temporary directory and returns its
+// name.  The file is closed when the test finishes.
+func openTestAiff(t *testing.T, a *AiffFile, description AudioDescription) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), "out.aiff")
+	err := a.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	return fileName
+}
+
+func TestAiffFileWriteChannelsInt32RejectsFloat(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 32, Format: FormatIEEEFloat}
+	a := AiffFile{AIFC: true}
+	openTestAiff(t, &a, description)
+
+	err := a.WriteChannelsInt32([]int32{0, 1 << 30})
+	if err == nil {
+		t.Error("WriteChannelsInt32 succeeded for float samples")
+	}
+}
+
+func TestAiffFileWriteChannelsInt32RejectsFloatAIFC(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 32, Format: FormatIEEEFloat}
+	a := AiffFile{FloatAIFC: true}
+	openTestAiff(t, &a, description)
+
+	err := a.WriteChannelsInt32([]int32{0, 1 << 30})
+	if err == nil {
+		t.Error("WriteChannelsInt32 succeeded for a file opened with FloatAIFC")
+	}
+}
+
+func TestAiffFileOpenRejectsNoChannels(t *testing.T) {
+	for _, channels := range []int16{0, -1} {
+		description := AudioDescription{NumChannels: channels, SampleRate: 48000, BitsPerSample: 16}
+
+		var a AiffFile
+		err := a.Open(filepath.Join(t.TempDir(), "out.aiff"), description)
+		if err == nil {
+			a.Close()
+			t.Errorf("Open succeeded with %d channels", channels)
+		}
+	}
+}
+
+func TestAiffFilePreallocate(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 8}
+
+	var a AiffFile
+	fileName := openTestAiff(t, &a, description)
+
+	err := a.WriteChannels([]float64{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Preallocate(1)
+	if err == nil {
+		t.Error("Preallocate accepted fewer frames than were written")
+	}
+
+	// An odd amount of sound data is followed by a pad byte.
+	err = a.Preallocate(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := EstimateFileSize(FormatAiff, description, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != want {
+		t.Errorf("the preallocated file is %d bytes, want %d", info.Size(), want)
+	}
+}
+
+func TestAiffFileWriteEmptyChannels(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16}
+
+	var a AiffFile
+	fileName := openTestAiff(t, &a, description)
+
+	err := a.WriteChannels([]float64{}, []float64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadAiffFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Channels) != 2 || len(data.Channels[0]) != 0 {
+		t.Errorf("got %d channels of %d frames, want 2 empty channels", len(data.Channels), len(data.Channels[0]))
+	}
+}
+
+// writeTestAiff writes the channels to a new file and returns its contents.
+func writeTestAiff(t *testing.T, a *AiffFile, description AudioDescription, channels ...[]float64) []byte {
+	t.Helper()
+
+	fileName := openTestAiff(t, a, description)
+	err := a.WriteChannels(channels...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return contents
+}
+
+func TestAiffFileAIFCRoundTrip(t *testing.T) {
+	tests := []struct {
+		description AudioDescription
+		compression string
+	}{
+		{AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16}, "NONE"},
+		{AudioDescription{NumChannels: 1, SampleRate: 48000, BitsPerSample: 24}, "NONE"},
+		{AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 32, Format: FormatIEEEFloat}, "fl32"},
+		{AudioDescription{NumChannels: 1, SampleRate: 96000, BitsPerSample: 64, Format: FormatIEEEFloat}, "fl64"},
+	}
+
+	samples := []float64{-1, -0.5, 0, 0.25, 1}
+
+	for _, test := range tests {
+		channels := make([][]float64, test.description.NumChannels)
+		for i := range channels {
+			channels[i] = samples
+		}
+		contents := writeTestAiff(t, &AiffFile{AIFC: true}, test.description, channels...)
+
+		if string(contents[8:12]) != "AIFC" {
+			t.Errorf("%+v: the FORM type is %q, want AIFC", test.description, contents[8:12])
+		}
+
+		// FVER comes first and holds the timestamp of the AIFC version.
+		fver := []byte{'F', 'V', 'E', 'R', 0, 0, 0, 4, 0xa2, 0x80, 0x51, 0x40}
+		if !bytes.Equal(contents[12:24], fver) {
+			t.Errorf("%+v: got FVER chunk % x, want % x", test.description, contents[12:24], fver)
+		}
+
+		// The extended COMM chunk names the compression type after the
+		// sample rate.
+		comm := contents[24:]
+		if string(comm[0:4]) != "COMM" {
+			t.Fatalf("%+v: got chunk %q after FVER, want COMM", test.description, comm[0:4])
+		}
+		if size := binary.BigEndian.Uint32(comm[4:8]); size < 22 || size%2 != 0 {
+			t.Errorf("%+v: the COMM chunk is %d bytes", test.description, size)
+		}
+		if string(comm[26:30]) != test.compression {
+			t.Errorf("%+v: the compression type is %q, want %q", test.description, comm[26:30], test.compression)
+		}
+
+		data, err := readAiff(bytes.NewReader(contents), int64(len(contents)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameFormat(data.Description, test.description) {
+			t.Errorf("read description %+v, want %+v", data.Description, test.description)
+		}
+		for i, want := range samples {
+			if got := data.Channels[0][i]; math.Abs(got-want) > 1.0/(1<<15) {
+				t.Errorf("%+v: sample %d is %v, want %v", test.description, i, got, want)
+			}
+		}
+	}
+}
+
+func TestAiffFilePlainHasNoFVER(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+	contents := writeTestAiff(t, &AiffFile{}, description, []float64{0})
+
+	if string(contents[8:12]) != "AIFF" {
+		t.Errorf("the FORM type is %q, want AIFF", contents[8:12])
+	}
+	if string(contents[12:16]) != "COMM" || binary.BigEndian.Uint32(contents[16:20]) != 18 {
+		t.Errorf("got chunk %q of %d bytes, want an 18-byte COMM chunk", contents[12:16], binary.BigEndian.Uint32(contents[16:20]))
+	}
+}
+
+func TestAiffFileCloseFlushError(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	a := AiffFile{TargetSampleRate: 48000, StrictClip: true}
+	openTestAiff(t, &a, description)
+
+	err := a.WriteChannels([]float64{0, 1.5, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Close()
+	var clipErr *ClipError
+	if !errors.As(err, &clipErr) {
+		t.Fatalf("Close returned %v, want a *ClipError", err)
+	}
+
+	if err := a.file.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("the file is still open after Close failed: %v", err)
+	}
+	if err := a.Close(); err != ErrClosed {
+		t.Errorf("a second Close returned %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,223 @@
+package audioExport
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// AiffData holds the contents of a decoded .aiff or .aifc file.
+type AiffData struct {
+	Description AudioDescription
+	Channels    [][]float64
+}
+
+// ReadAiffFile decodes the .aiff or .aifc file with the given name.  The
+// samples of each channel are converted to float64 values ranging from -1 to
+// 1.  AIFC files must be uncompressed, either big-endian (NONE) or
+// little-endian (sowt) integers, or big-endian floats (fl32 or fl64).
+func ReadAiffFile(fileName string) (*AiffData, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return readAiff(file, info.Size())
+}
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// readAiff decodes a .aiff or .aifc stream of the given size, which is -1
+// if unknown.
+func readAiff(r io.Reader, fileSize int64) (*AiffData, error) {
+	var err error
+
+	header := make([]byte, 12)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The number of bytes left in the file, if it's known, is used to reject
+	// chunk sizes that can't be right.
+	remaining := int64(-1)
+	if fileSize >= 0 {
+		remaining = fileSize - 12
+	}
+
+	if string(header[0:4]) != "FORM" {
+		return nil, errors.New("Unrecognized file magic; expected FORM.")
+	}
+
+	var isAifc bool
+	switch string(header[8:12]) {
+	case "AIFF":
+		isAifc = false
+	case "AIFC":
+		isAifc = true
+	default:
+		return nil, errors.New("The file is not an AIFF or AIFC file.")
+	}
+
+	// The sample data of AIFF is always big-endian, while AIFC declares its
+	// byte order through the compression type in the COMM chunk.
+	var order binary.ByteOrder = binary.BigEndian
+
+	data := new(AiffData)
+	haveComm := false
+	haveData := false
+
+	for {
+		id, chunkSize, err := readChunkHeader(r, binary.BigEndian)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		remaining -= 8
+		body, err := readChunkBody(r, chunkSize, remaining)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= int64(chunkSize)
+
+		switch id {
+		case "COMM":
+			data.Description, order, err = parseCommonChunk(body, isAifc)
+			if err != nil {
+				return nil, err
+			}
+			haveComm = true
+		case "SSND":
+			if !haveComm {
+				return nil, errors.New("The SSND chunk appears before the COMM chunk.")
+			}
+			if len(body) < 8 {
+				return nil, errors.New("The SSND chunk is too short.")
+			}
+
+			// The offset and block size are followed by offset bytes of
+			// padding before the first sample frame.
+			offset := binary.BigEndian.Uint32(body[0:4])
+			if uint64(offset) > uint64(len(body)-8) {
+				return nil, errors.New("The SSND offset exceeds the size of the chunk.")
+			}
+			data.Channels = decodeSamples(body[8+offset:], data.Description, order, true)
+			haveData = true
+		}
+
+		// Chunks are padded to an even number of bytes.
+		if chunkSize%2 == 1 {
+			_, err = io.ReadFull(r, make([]byte, 1))
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			remaining--
+		}
+	}
+
+	if !haveData {
+		return nil, errors.New("The file has no SSND chunk.")
+	}
+
+	return data, nil
+}
+
+// parseCommonChunk reads the audio description from the body of a COMM chunk
+// along with the byte order of the samples.
+func parseCommonChunk(body []byte, isAifc bool) (AudioDescription, binary.ByteOrder, error) {
+	var desc AudioDescription
+	var order binary.ByteOrder = binary.BigEndian
+
+	if len(body) < 18 {
+		return desc, order, errors.New("The COMM chunk is too short.")
+	}
+
+	desc.NumChannels = int16(binary.BigEndian.Uint16(body[0:2]))
+	desc.BitsPerSample = int16(binary.BigEndian.Uint16(body[6:8]))
+
+	sampleRate, err := decodeSampleRate(body[8:18])
+	if err != nil {
+		return desc, order, err
+	}
+	desc.SampleRate = uint32(math.Round(sampleRate))
+	if float64(desc.SampleRate) != sampleRate {
+		desc.exactRate = sampleRate
+	}
+
+	if isAifc {
+		if len(body) < 22 {
+			return desc, order, errors.New("The COMM chunk is too short.")
+		}
+
+		switch string(body[18:22]) {
+		case "NONE":
+			order = binary.BigEndian
+		case "sowt":
+			order = binary.LittleEndian
+		case "fl32", "FL32":
+			desc.Format = FormatIEEEFloat
+			desc.BitsPerSample = BPS32
+		case "fl64", "FL64":
+			desc.Format = FormatIEEEFloat
+			desc.BitsPerSample = BPS64
+		default:
+			return desc, order, errors.New("Unsupported AIFC compression type.")
+		}
+	}
+
+	if desc.NumChannels <= 0 {
+		return desc, order, errors.New("The COMM chunk has an invalid number of channels.")
+	}
+
+	// Samples are stored in the smallest whole number of bytes that holds
+	// them, e.g. 20-bit samples in 24-bit containers.
+	containerBits := (desc.BitsPerSample + 7) / 8 * 8
+	if containerBits != desc.BitsPerSample {
+		desc.ContainerBits = containerBits
+	}
+
+	switch desc.containerBits() {
+	case BPS8, BPS16, BPS24, BPS32:
+	case BPS64:
+		if !desc.isFloat() {
+			return desc, order, errors.New("Invalid bit depth.")
+		}
+	default:
+		return desc, order, errors.New("Invalid bit depth.")
+	}
+
+	return desc, order, nil
+}
+
+// decodeSampleRate is the reverse of convertSampleRate.  It parses the 80-bit
+// IEEE extended precision float of any encoder.
+func decodeSampleRate(b []byte) (float64, error) {
+	exponent := binary.BigEndian.Uint16(b[0:2])
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+
+	// The sign bit must be clear and the exponent can't be the one reserved
+	// for infinities and NaNs.
+	if exponent&0x8000 != 0 || exponent == 0x7FFF || mantissa == 0 {
+		return 0, errors.New("Invalid sample rate")
+	}
+
+	rate := math.Ldexp(float64(mantissa), int(exponent)-16383-63)
+	if !(rate >= 1) || rate > math.MaxUint32 {
+		return 0, errors.New("Invalid sample rate")
+	}
+
+	return rate, nil
+}
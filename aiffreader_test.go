@@ -0,0 +1,117 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestReadAiffSSNDOffset(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	// Keep the FORM and COMM chunks of a standard header and replace its
+	// SSND chunk with one whose samples follow 4 bytes of padding.
+	header, err := AiffHeader(description, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := append([]byte(nil), header[:len(header)-16]...)
+
+	ssnd := new(bytes.Buffer)
+	ssnd.WriteString("SSND")
+	binary.Write(ssnd, binary.BigEndian, []uint32{8 + 4 + 4, 4, 0})
+	ssnd.Write([]byte{0xde, 0xad, 0xbe, 0xef})
+	ssnd.Write([]byte{0x40, 0x00, 0xc0, 0x00})
+	file = append(file, ssnd.Bytes()...)
+	binary.BigEndian.PutUint32(file[4:8], uint32(len(file)-8))
+
+	data, err := readAiff(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{SampleToFloat(0x4000, 16), SampleToFloat(-0x4000, 16)}
+	if len(data.Channels[0]) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(data.Channels[0]), len(want))
+	}
+	for i := range want {
+		if data.Channels[0][i] != want[i] {
+			t.Errorf("frame %d is %v, want %v", i, data.Channels[0][i], want[i])
+		}
+	}
+
+	// An offset beyond the end of the chunk is rejected.
+	binary.BigEndian.PutUint32(file[len(header)-16+8:], 9)
+	_, err = readAiff(bytes.NewReader(file), int64(len(file)))
+	if err == nil {
+		t.Error("an offset beyond the end of the SSND chunk was accepted")
+	}
+}
+
+func TestDecodeSampleRate(t *testing.T) {
+	tests := []struct {
+		encoded []byte
+		want    float64
+	}{
+		{[]byte{0x40, 0x0b, 0xfa, 0x00, 0, 0, 0, 0, 0, 0}, 8000},
+		{[]byte{0x40, 0x0c, 0xac, 0x44, 0, 0, 0, 0, 0, 0}, 11025},
+		{[]byte{0x40, 0x0d, 0xac, 0x44, 0, 0, 0, 0, 0, 0}, 22050},
+		{[]byte{0x40, 0x0f, 0xbb, 0x80, 0, 0, 0, 0, 0, 0}, 96000},
+		{[]byte{0x40, 0x10, 0xbb, 0x80, 0, 0, 0, 0, 0, 0}, 192000},
+		{[]byte{0x40, 0x11, 0xbb, 0x80, 0, 0, 0, 0, 0, 0}, 384000},
+		{[]byte{0x40, 0x0d, 0xe5, 0x8a, 0x80, 0, 0, 0, 0, 0}, 29381.25},
+
+		// Some encoders don't normalize the mantissa.
+		{[]byte{0x40, 0x0c, 0x7d, 0x00, 0, 0, 0, 0, 0, 0}, 8000},
+	}
+
+	for _, test := range tests {
+		got, err := decodeSampleRate(test.encoded)
+		if err != nil {
+			t.Errorf("% x: %v", test.encoded, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("% x decoded as %v, want %v", test.encoded, got, test.want)
+		}
+	}
+}
+
+func TestAiffSampleRateRoundTrip(t *testing.T) {
+	for _, rate := range []float64{1, 8000, 11025, 22050, 32000, 88200, 96000, 176400, 192000, 44100.5, 29970.03} {
+		a := AiffFile{}
+		err := a.reset(NewAudioDescription(1, rate, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encoded, err := a.convertSampleRate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := decodeSampleRate(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != rate {
+			t.Errorf("%v Hz round trips to %v Hz", rate, got)
+		}
+	}
+}
+
+func TestDecodeSampleRateErrors(t *testing.T) {
+	tests := [][]byte{
+		{0xc0, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0}, // Negative
+		{0x7f, 0xff, 0x80, 0x00, 0, 0, 0, 0, 0, 0}, // Infinity
+		{0x40, 0x0e, 0x00, 0x00, 0, 0, 0, 0, 0, 0}, // Zero mantissa
+		{0x3f, 0xfe, 0x80, 0x00, 0, 0, 0, 0, 0, 0}, // 0.5 Hz
+	}
+
+	for _, encoded := range tests {
+		_, err := decodeSampleRate(encoded)
+		if err == nil {
+			t.Errorf("% x was decoded without an error", encoded)
+		}
+	}
+}
@@ -1,11 +1,145 @@
 // Package audioExport provides structures for creating uncompressed audio
 // files without linking to external C libraries.
+//
+// # Writer options
+//
+// WaveFile and AiffFile share the following options, which behave the same
+// way in both.  Unless noted otherwise, they only affect samples given as
+// floats: bytes given to WriteBytes and WriteChannelsInt32 are written as is.
+//
+// TargetSampleRate, if set, is the sample rate written to the file.  The
+// channels given to WriteChannels are then buffered in memory at the
+// description's sample rate and resampled when the file is closed, so the
+// whole signal must fit in memory.  Raw bytes can't be resampled, so
+// WriteBytes and WriteChannelsInt32 return an error in this mode.
+//
+// Limiter, if set, is applied to the channels when the file is closed,
+// which controls peaks more musically than clipping each sample.  Like
+// TargetSampleRate, it buffers the channels given to WriteChannels in
+// memory, which takes 8 bytes per sample plus 24 bytes per frame while
+// limiting, and WriteBytes and WriteChannelsInt32 return an error.  It acts
+// before any channel gain or ReferenceScale, after any resampling.
+//
+// ReferenceScale, if set, is the fraction of full scale that a sample of 1.0
+// is written at, which builds headroom into the file.  For example,
+// DBToLinear(-18) follows EBU R68, where the 0 dBu alignment level sits at
+// -18 dBFS.  It applies along with any channel gain.
+//
+// StrictClip makes writing fail with a *ClipError on the first sample
+// outside the range -1.0 to 1.0, after any channel gain and ReferenceScale,
+// instead of clipping it.  With TargetSampleRate, the resampled samples are
+// checked when the file is closed.
+//
+// Dither adds dither to samples before they're quantized, which matters when
+// reducing a high-resolution source to a 16-bit master.  It's applied after
+// the channel gain, ReferenceScale and StrictClip check.  Floating-point
+// files are never dithered.  The default is DitherNone.
+//
+// WriteSidecar makes Close write a JSON description of the file next to it,
+// named after the file with .json appended.  It holds the description, frame
+// count, duration, peak and RMS levels and the number of clipped samples, as
+// a SidecarInfo.  The levels are taken before dither.
+//
+// OverviewBinSize, if set, makes the file record the minimum and maximum of
+// each channel over every OverviewBinSize frames as they're written, which
+// WaveformOverview returns for drawing the waveform.  It costs 16 bytes per
+// bin per channel.  The samples are recorded after any channel gain and
+// ReferenceScale and before clipping.
+//
+// MeasureLoudness makes the file measure the integrated loudness of the
+// samples following ITU-R BS.1770, which IntegratedLoudness returns.  It's
+// measured after any channel gain, ReferenceScale and Limiter, as the
+// samples are written.
+//
+// CheckExtension makes the Open methods fail if the extension of the file
+// name doesn't match the format, e.g. when passing out.mp3.  It's off by
+// default so that unusual extensions keep working.
 package audioExport
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrClosed is returned when writing to a file that has already been closed
+// or was never opened.
+var ErrClosed = errors.New("The file is closed.")
+
+// ClipError is returned when StrictClip is set and a sample falls outside the
+// range -1.0 to 1.0.
+type ClipError struct {
+	Channel int     // The index of the channel
+	Frame   uint64  // The index of the frame from the start of the file
+	Value   float64 // The sample, after any channel gain and reference scale
+}
+
+func (e *ClipError) Error() string {
+	return fmt.Sprintf("The sample %g in channel %d at frame %d is out of range.", e.Value, e.Channel, e.Frame)
+}
+
+// ErrShortWrite is matched by errors.Is when the sample data couldn't be
+// written in full.  The error is a *ShortWriteError with the details.
+var ErrShortWrite = errors.New("The data was only partially written.")
+
+// ShortWriteError is returned when the sample data couldn't be written in
+// full, such as when the disk is full or the file is on a read-only
+// filesystem.  It unwraps to the error returned by the writer.
+type ShortWriteError struct {
+	Written   int   // The number of bytes that were written
+	Requested int   // The number of bytes that should have been written
+	DiskFull  bool  // Whether the writer failed with ENOSPC
+	Err       error // The error returned by the writer
+}
+
+func (e *ShortWriteError) Error() string {
+	if e.DiskFull {
+		return fmt.Sprintf("Only %d of %d bytes were written because the disk is full (%v).", e.Written, e.Requested, e.Err)
+	}
+	return fmt.Sprintf("Only %d of %d bytes were written (%v).", e.Written, e.Requested, e.Err)
+}
+
+// Is makes errors.Is report a match for ErrShortWrite.
+func (e *ShortWriteError) Is(target error) bool {
+	return target == ErrShortWrite
+}
+
+func (e *ShortWriteError) Unwrap() error {
+	return e.Err
+}
+
+// ErrChannelCountMismatch is matched by errors.Is when the number of channels
+// or samples supplied doesn't equal the number of channels in the
+// description.  The error is a *ChannelCountError with the counts.
+var ErrChannelCountMismatch = errors.New("The number of audio channels doesn't equal the number of streams supplied.")
+
+// ChannelCountError is returned when the number of channels or samples
+// supplied doesn't equal the number of channels in the description.
+type ChannelCountError struct {
+	Expected int // The number of channels in the description
+	Actual   int // The number of channels or samples supplied
+}
+
+func (e *ChannelCountError) Error() string {
+	return fmt.Sprintf("The number of audio channels doesn't equal the number of streams supplied: expected %d channels, got %d.", e.Expected, e.Actual)
+}
+
+// Is makes errors.Is report a match for ErrChannelCountMismatch.
+func (e *ChannelCountError) Is(target error) bool {
+	return target == ErrChannelCountMismatch
+}
+
+// AudioFile is implemented by each of the supported file types.
 type AudioFile interface {
 	Open(fileName string, description AudioDescription) error
 	WriteChannels(channels ...[]float64) error
 	Close() error
+	AudioDescription() AudioDescription
 }
 
 // AudioDescription describes the format of the audio data.
@@ -13,6 +147,135 @@ type AudioDescription struct {
 	NumChannels   int16
 	SampleRate    uint32
 	BitsPerSample int16
+
+	// ContainerBits is the number of bits used to store each sample on disk.
+	// It allows float data of a higher precision (e.g. 32 BitsPerSample) to be
+	// written at a lower depth such as 24-bit.  If BitsPerSample is less than
+	// ContainerBits, as with 20-bit audio in 24-bit containers, only the top
+	// BitsPerSample bits of each sample carry signal and the rest are zero.  If
+	// ContainerBits is 0, samples are stored using BitsPerSample.
+	ContainerBits int16
+
+	// Format selects how samples are encoded.  The default is integer PCM.
+	// IEEE floating-point samples require a BitsPerSample of 32 or 64.
+	Format WaveFormat
+
+	// exactRate holds the sample rate given to NewAudioDescription, which may
+	// not be an integer.
+	exactRate float64
+}
+
+// NewAudioDescription returns a description with the given sample rate, which
+// doesn't need to be an integer.  SampleRate is set to the nearest integer
+// rate, while formats that store the rate as a float, such as AIFF, keep the
+// exact rate.
+func NewAudioDescription(channels int16, rate float64, bits int16) AudioDescription {
+	return AudioDescription{
+		NumChannels:   channels,
+		SampleRate:    uint32(math.Round(rate)),
+		BitsPerSample: bits,
+		exactRate:     rate,
+	}
+}
+
+// sampleRate returns the exact sample rate.  The rate given to
+// NewAudioDescription is only used if SampleRate hasn't been changed since.
+func (d AudioDescription) sampleRate() float64 {
+	if d.exactRate != 0 && uint32(math.Round(d.exactRate)) == d.SampleRate {
+		return d.exactRate
+	}
+	return float64(d.SampleRate)
+}
+
+// containerBits returns the number of bits used to store each sample on disk.
+func (d AudioDescription) containerBits() int16 {
+	if d.ContainerBits != 0 {
+		return d.ContainerBits
+	}
+	return d.BitsPerSample
+}
+
+// isFloat returns whether the samples are IEEE floating-point numbers.
+func (d AudioDescription) isFloat() bool {
+	return d.Format == FormatIEEEFloat
+}
+
+// validBits returns the number of bits of each stored sample that carry
+// signal.
+func (d AudioDescription) validBits() int16 {
+	if d.BitsPerSample > 0 && d.BitsPerSample < d.containerBits() {
+		return d.BitsPerSample
+	}
+	return d.containerBits()
+}
+
+// FrameToDuration returns the time at which the given sample frame begins,
+// rounded to the nearest nanosecond.  It returns 0 if the sample rate is 0.
+func (d AudioDescription) FrameToDuration(frame uint64) time.Duration {
+	if d.SampleRate == 0 {
+		return 0
+	}
+
+	// Split the frame count into whole seconds and a remainder so that the
+	// multiplication doesn't overflow for long files.
+	rate := uint64(d.SampleRate)
+	seconds := frame / rate
+	remainder := frame % rate
+
+	nanos := (remainder*uint64(time.Second) + rate/2) / rate
+	return time.Duration(seconds)*time.Second + time.Duration(nanos)
+}
+
+// DurationToFrame returns the index of the sample frame nearest to the given
+// time.  Negative durations map to frame 0, as does a sample rate of 0.
+func (d AudioDescription) DurationToFrame(t time.Duration) uint64 {
+	if d.SampleRate == 0 || t <= 0 {
+		return 0
+	}
+
+	rate := uint64(d.SampleRate)
+	seconds := uint64(t / time.Second)
+	remainder := uint64(t % time.Second)
+
+	frames := (remainder*rate + uint64(time.Second)/2) / uint64(time.Second)
+	return seconds*rate + frames
+}
+
+// FramesForLatency returns the number of frames that span the given latency
+// at the description's sample rate, rounded to the nearest frame.  It's the
+// size of the blocks to pass to WriteChannels for real-time work.  Any
+// positive latency gives at least one frame.
+func FramesForLatency(desc AudioDescription, latency time.Duration) int {
+	frames := int(desc.DurationToFrame(latency))
+	if frames == 0 && latency > 0 && desc.SampleRate != 0 {
+		frames = 1
+	}
+	return frames
+}
+
+// BytesForLatency is like FramesForLatency, but it returns the number of
+// bytes that the frames take up once muxed, which suits WriteBytes.
+func BytesForLatency(desc AudioDescription, latency time.Duration) int {
+	return FramesForLatency(desc, latency) * int(desc.NumChannels) * int(desc.containerBits()) / 8
+}
+
+// FloatToSample converts a sample in the range -1.0 to 1.0 to a signed
+// integer of the given number of bits, exactly as the writers quantize
+// samples given as floats.  The scale is symmetric, so 1.0 maps to the
+// largest positive value and -1.0 to its negation, and out-of-range samples
+// are clamped.  Unsigned 8-bit WAV samples don't use this scale: -1.0 to 1.0
+// maps onto 0 to 255, so 0.5 is stored as 191 rather than 128 plus
+// FloatToSample(0.5, 8).  The number of bits must be between 2 and 32.
+func FloatToSample(f float64, bits int16) int32 {
+	return quantize(f, bits)
+}
+
+// SampleToFloat converts a signed integer sample of the given number of bits
+// to a float, exactly as the decoders do.  It's the inverse of FloatToSample,
+// so FloatToSample(SampleToFloat(s, bits), bits) returns s for every sample.
+// The number of bits must be between 2 and 32.
+func SampleToFloat(sample int32, bits int16) float64 {
+	return float64(sample) / float64(int64(1)<<uint(bits-1)-1)
 }
 
 // The SampleRate constants provide a list of the most common sample rates.
@@ -25,10 +288,185 @@ const (
 	SampleRate192k  uint32 = 192000
 )
 
+// WaveFormat identifies the encoding of the samples in a file.
+type WaveFormat int16
+
+// The WaveFormat constants list the possible values for the Format member of
+// the AudioDescription struct.
+const (
+	FormatPCM WaveFormat = iota
+	FormatIEEEFloat
+)
+
 // The BPS constants list the possible values for the BitsPerSample member of
 // the Audio Description struct.
 const (
 	BPS8  int16 = 8
 	BPS16 int16 = 16
+	BPS24 int16 = 24
 	BPS32 int16 = 32
+	BPS64 int16 = 64
 )
+
+// silenceBlockSize is the number of frames of silence written at a time.
+const silenceBlockSize = 4096
+
+// writeSilence writes the given number of frames of silence to the file in
+// blocks, so that long gaps don't require a large allocation.
+func writeSilence(file AudioFile, frames uint64) error {
+	numChannels := int(file.AudioDescription().NumChannels)
+
+	block := make([]float64, silenceBlockSize)
+	channels := make([][]float64, numChannels)
+
+	for frames > 0 {
+		n := uint64(silenceBlockSize)
+		if frames < n {
+			n = frames
+		}
+
+		for i := range channels {
+			channels[i] = block[:n]
+		}
+
+		err := file.WriteChannels(channels...)
+		if err != nil {
+			return err
+		}
+
+		frames -= n
+	}
+
+	return nil
+}
+
+// createContext creates the file in a goroutine so that the caller can stop
+// waiting when the context is done.  If that happens, the file is closed and
+// removed once the create finally returns.
+func createContext(ctx context.Context, fileName string) (*os.File, error) {
+	return createWithContext(ctx, func() (*os.File, error) {
+		return os.Create(fileName)
+	})
+}
+
+// createWithContext calls create in a goroutine, returning ctx.Err() if the
+// context is done first.  A file created after that is closed and removed.
+func createWithContext(ctx context.Context, create func() (*os.File, error)) (*os.File, error) {
+	type result struct {
+		file *os.File
+		err  error
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		file, err := create()
+		done <- result{file, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.file, res.err
+	case <-ctx.Done():
+		go func() {
+			res := <-done
+			if res.err == nil {
+				res.file.Close()
+				os.Remove(res.file.Name())
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// quantize converts a sample in the range -1.0 to 1.0 to a signed integer of
+// the given number of bits.  The scale is symmetric, so 1.0 and -1.0 map to
+// the largest positive value and its negation respectively, and out-of-range
+// samples are clamped.  Only samples below -1.0 reach the most negative value.
+func quantize(data float64, bits int16) int32 {
+	max := float64(int64(1)<<uint(bits-1) - 1)
+
+	res := math.Round(data * max)
+	if res < -max-1 {
+		res = -max - 1
+	} else if res > max {
+		res = max
+	}
+
+	return int32(res)
+}
+
+// shortWrite wraps the error from a write of requested bytes of which n were
+// written in a *ShortWriteError.  It returns nil if the write succeeded.
+func shortWrite(n, requested int, err error) error {
+	if err == nil && n == requested {
+		return nil
+	}
+
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+
+	return &ShortWriteError{
+		Written:   n,
+		Requested: requested,
+		DiskFull:  errors.Is(err, syscall.ENOSPC),
+		Err:       err,
+	}
+}
+
+// truncateToPosition truncates the file at its current offset, discarding any
+// space reserved beyond the data written.
+func truncateToPosition(file *os.File) error {
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	return file.Truncate(pos)
+}
+
+// seekableAtStart returns whether the file can seek and is positioned at its
+// start, which rules out pipes and terminals.
+func seekableAtStart(file *os.File) bool {
+	pos, err := file.Seek(0, io.SeekCurrent)
+	return err == nil && pos == 0
+}
+
+// fileInfo returns the path of a finished file along with its size.
+func fileInfo(fileName string) (string, int64, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return fileName, info.Size(), nil
+}
+
+// dataWriter adapts the WriteBytes and Close methods of a file to an
+// io.WriteCloser.
+type dataWriter struct {
+	writeBytes func(bytes []byte) error
+	close      func() error
+}
+
+func (d dataWriter) Write(p []byte) (int, error) {
+	err := d.writeBytes(p)
+	if err != nil {
+		var short *ShortWriteError
+		if errors.As(err, &short) {
+			return short.Written, err
+		}
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (d dataWriter) Close() error {
+	return d.close()
+}
@@ -0,0 +1,103 @@
+package audioExport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFloatToSampleRoundTrip(t *testing.T) {
+	for _, bits := range []int16{8, 16} {
+		max := int32(1)<<uint(bits-1) - 1
+		for sample := -max - 1; sample <= max; sample++ {
+			if got := FloatToSample(SampleToFloat(sample, bits), bits); got != sample {
+				t.Fatalf("%d bits: %d round trips to %d", bits, sample, got)
+			}
+		}
+	}
+
+	for _, bits := range []int16{24, 32} {
+		max := int64(1)<<uint(bits-1) - 1
+		for _, sample := range []int64{-max - 1, -max, -12345, -1, 0, 1, 12345, max - 1, max} {
+			if got := FloatToSample(SampleToFloat(int32(sample), bits), bits); int64(got) != sample {
+				t.Errorf("%d bits: %d round trips to %d", bits, sample, got)
+			}
+		}
+	}
+}
+
+// The unsigned 8-bit samples of a WAV use their own scale, which
+// FloatToSample doesn't describe.
+func TestFloatToSampleUnsigned8Bit(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 8000, BitsPerSample: 8}
+	fileName := filepath.Join(t.TempDir(), "out.wav")
+
+	var w WaveFile
+	err := w.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteChannels([]float64{-1, 0, 0.5, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := contents[len(contents)-4:]
+	want := []byte{0, 128, 191, 255}
+	for i := range want {
+		if data[i] != want[i] {
+			t.Errorf("sample %d is %d, want %d", i, data[i], want[i])
+		}
+	}
+
+	if got := FloatToSample(0.5, 8); got != 64 {
+		t.Errorf("FloatToSample(0.5, 8) = %d, want 64", got)
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	tests := []struct {
+		data float64
+		bits int16
+		want int32
+	}{
+		{-1, 16, -32767},
+		{0, 16, 0},
+		{1, 16, 32767},
+		{-1, 24, -8388607},
+		{1, 24, 8388607},
+		{-1, 32, -2147483647},
+		{1, 32, 2147483647},
+
+		// Out-of-range samples are clamped to the full integer range.
+		{1.5, 16, 32767},
+		{-1.5, 16, -32768},
+		{-1.5, 32, -2147483648},
+		{2, 8, 127},
+		{-2, 8, -128},
+
+		// Ties round away from zero.
+		{0.5, 3, 2},
+		{-0.5, 3, -2},
+		{0.5, 2, 1},
+		{-0.5, 2, -1},
+		{0.25, 2, 0},
+	}
+
+	for _, test := range tests {
+		if got := quantize(test.data, test.bits); got != test.want {
+			t.Errorf("quantize(%v, %d) = %d, want %d", test.data, test.bits, got, test.want)
+		}
+	}
+}
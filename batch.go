@@ -0,0 +1,109 @@
+package audioExport
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ExportJob is one of the files written by BatchExport.
+type ExportJob struct {
+	FileName    string
+	Format      FileFormat // FormatWave by default
+	Description AudioDescription
+	Channels    [][]float64
+}
+
+// ExportError is returned by BatchExport for each job that failed, naming the
+// file it was writing.
+type ExportError struct {
+	FileName string
+	Err      error
+}
+
+func (e *ExportError) Error() string {
+	return fmt.Sprintf("%s: %v", e.FileName, e.Err)
+}
+
+func (e *ExportError) Unwrap() error {
+	return e.Err
+}
+
+// BatchExport writes each job to a complete file, running as many jobs at
+// once as runtime.GOMAXPROCS allows.  See BatchExportWorkers.
+func BatchExport(jobs []ExportJob) error {
+	return BatchExportWorkers(jobs, runtime.GOMAXPROCS(0))
+}
+
+// BatchExportWorkers writes each job to a complete file, running up to
+// workers jobs at once, which suits writing many short clips.  A failed job
+// doesn't stop the others.  The error of each failed job is returned as an
+// *ExportError, joined in the order of the jobs.  AIFF jobs with a float
+// description are written as AIFC files.  If workers is less than 1, a single
+// worker is used.
+func BatchExportWorkers(jobs []ExportJob, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	errs := make([]error, len(jobs))
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				err := exportJob(jobs[index])
+				if err != nil {
+					errs[index] = &ExportError{FileName: jobs[index].FileName, Err: err}
+				}
+			}
+		}()
+	}
+
+	for i := range jobs {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// exportJob writes one of the jobs of BatchExportWorkers.
+func exportJob(job ExportJob) error {
+	var err error
+
+	var file AudioFile
+	switch job.Format {
+	case FormatWave:
+		file = new(WaveFile)
+	case FormatAiff:
+		file = &AiffFile{FloatAIFC: true}
+	default:
+		return errors.New("Unsupported file format.")
+	}
+
+	err = file.Open(job.FileName, job.Description)
+	if err != nil {
+		return err
+	}
+
+	err = file.WriteChannels(job.Channels...)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,167 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// The bext constants give the offsets of the version and loudness value
+// fields from the start of the body of a bext chunk.
+const (
+	bextVersionOffset  = 346
+	bextLoudnessOffset = 412
+)
+
+// BroadcastExtension holds the fields of a Broadcast Wave Format (EBU Tech
+// 3285) bext chunk.
+type BroadcastExtension struct {
+	Description         string // At most 256 characters
+	Originator          string // At most 32 characters
+	OriginatorReference string // At most 32 characters
+
+	// OriginationTime is the date and time the audio was created.  It's
+	// written in the local time of its location, to the second.  If it's the
+	// zero time, the fields are left blank.
+	OriginationTime time.Time
+
+	// TimeReference is the number of samples since midnight of the first
+	// sample in the file.
+	TimeReference uint64
+
+	// UMID is the SMPTE 330M unique material identifier, which is either a
+	// 32-byte basic UMID or a 64-byte extended UMID.  A basic UMID is padded
+	// with zeros.
+	UMID []byte
+
+	// The loudness fields are measured following EBU R 128 and are stored to
+	// a hundredth of a unit.  If any of them is nonzero, a version 2 chunk is
+	// written; otherwise the loudness fields are left reserved and a version
+	// 1 chunk is written.
+	LoudnessValue        float64 // Integrated loudness in LUFS
+	LoudnessRange        float64 // Loudness range in LU
+	MaxTruePeakLevel     float64 // Maximum true peak level in dBTP
+	MaxMomentaryLoudness float64 // Highest momentary loudness in LUFS
+	MaxShortTermLoudness float64 // Highest short-term loudness in LUFS
+
+	// CodingHistory describes the processes applied to the audio, one
+	// CR/LF-terminated line per process.
+	CodingHistory string
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// encode returns the body of the bext chunk.
+func (b *BroadcastExtension) encode() ([]byte, error) {
+	var err error
+
+	if len(b.UMID) != 0 && len(b.UMID) != 32 && len(b.UMID) != 64 {
+		return nil, errors.New("The UMID must be 32 or 64 bytes long.")
+	}
+
+	buffer := new(bytes.Buffer)
+
+	// Text fields
+	err = writeFixedString(buffer, b.Description, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFixedString(buffer, b.Originator, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFixedString(buffer, b.OriginatorReference, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	// Origination date and time
+	date, clock := "", ""
+	if !b.OriginationTime.IsZero() {
+		date = b.OriginationTime.Format("2006-01-02")
+		clock = b.OriginationTime.Format("15:04:05")
+	}
+
+	err = writeFixedString(buffer, date, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFixedString(buffer, clock, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	// Time reference (low and high words)
+	err = binary.Write(buffer, binary.LittleEndian, b.TimeReference)
+	if err != nil {
+		return nil, err
+	}
+
+	// Version
+	loudness := []float64{
+		b.LoudnessValue,
+		b.LoudnessRange,
+		b.MaxTruePeakLevel,
+		b.MaxMomentaryLoudness,
+		b.MaxShortTermLoudness,
+	}
+
+	version := uint16(1)
+	for _, l := range loudness {
+		if l != 0 {
+			version = 2
+		}
+	}
+
+	err = binary.Write(buffer, binary.LittleEndian, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// UMID, zero-padded to 64 bytes
+	umid := make([]byte, 64)
+	copy(umid, b.UMID)
+	buffer.Write(umid)
+
+	// Loudness
+	reserved := 190
+	if version == 2 {
+		for _, l := range loudness {
+			if math.IsNaN(l) || math.Abs(l*100) > math.MaxInt16 {
+				return nil, errors.New("The loudness values must be between -327.67 and 327.67.")
+			}
+
+			err = binary.Write(buffer, binary.LittleEndian, int16(math.Round(l*100)))
+			if err != nil {
+				return nil, err
+			}
+		}
+		reserved = 180
+	}
+
+	// Reserved
+	buffer.Write(make([]byte, reserved))
+
+	// Coding history
+	buffer.WriteString(b.CodingHistory)
+
+	return buffer.Bytes(), nil
+}
+
+// writeFixedString writes s to the buffer, padded with zeros to size bytes.
+func writeFixedString(buffer *bytes.Buffer, s string, size int) error {
+	if len(s) > size {
+		return errors.New("A text field is too long for its chunk.")
+	}
+
+	buffer.WriteString(s)
+	buffer.Write(make([]byte, size-len(s)))
+	return nil
+}
@@ -0,0 +1,91 @@
+package audioExport
+
+import (
+	"math"
+)
+
+// Biquad is a second-order IIR filter, such as a low-pass or high-pass
+// filter, using the coefficients from the Audio EQ Cookbook.  A Biquad keeps
+// its state between calls to Process so that a long signal can be filtered
+// one block at a time.  Use a separate Biquad for each channel.
+type Biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// NewLowpass returns a low-pass filter with the given cutoff frequency in Hz
+// and quality factor.  A Q of 1/√2 (about 0.707) gives a maximally flat
+// response.
+func NewLowpass(cutoffHz, q float64, rate uint32) *Biquad {
+	w0, alpha := biquadParams(cutoffHz, q, rate)
+	cos := math.Cos(w0)
+
+	return newBiquad(
+		(1-cos)/2, 1-cos, (1-cos)/2,
+		1+alpha, -2*cos, 1-alpha,
+	)
+}
+
+// NewHighpass returns a high-pass filter with the given cutoff frequency in Hz
+// and quality factor.  A Q of 1/√2 (about 0.707) gives a maximally flat
+// response.
+func NewHighpass(cutoffHz, q float64, rate uint32) *Biquad {
+	w0, alpha := biquadParams(cutoffHz, q, rate)
+	cos := math.Cos(w0)
+
+	return newBiquad(
+		(1+cos)/2, -(1 + cos), (1+cos)/2,
+		1+alpha, -2*cos, 1-alpha,
+	)
+}
+
+// Process filters the channel and returns the result as a new slice.
+func (b *Biquad) Process(channel []float64) []float64 {
+	res := make([]float64, len(channel))
+
+	for i, x := range channel {
+		res[i] = b.processSample(x)
+	}
+
+	return res
+}
+
+// Reset clears the state of the filter so that it can be reused for an
+// unrelated signal.
+func (b *Biquad) Reset() {
+	b.x1, b.x2, b.y1, b.y2 = 0, 0, 0, 0
+}
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// processSample filters the next sample of the signal.
+func (b *Biquad) processSample(x float64) float64 {
+	y := b.b0*x + b.b1*b.x1 + b.b2*b.x2 - b.a1*b.y1 - b.a2*b.y2
+
+	b.x2, b.x1 = b.x1, x
+	b.y2, b.y1 = b.y1, y
+
+	return y
+}
+
+// biquadParams returns the angular frequency and alpha used by the filter
+// formulas.
+func biquadParams(cutoffHz, q float64, rate uint32) (float64, float64) {
+	w0 := 2 * math.Pi * cutoffHz / float64(rate)
+	alpha := math.Sin(w0) / (2 * q)
+	return w0, alpha
+}
+
+// newBiquad returns a filter with the given coefficients, normalized so that
+// a0 is 1.
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) *Biquad {
+	return &Biquad{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b2 / a0,
+		a1: a1 / a0,
+		a2: a2 / a0,
+	}
+}
@@ -0,0 +1,144 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// CartTimer is one of the eight timers of a cart chunk, which marks a point in
+// the audio such as the start of a segue or the end of an intro.
+type CartTimer struct {
+	Usage string // A four-character code such as SEGs, INTe or AUDs
+	Value uint32 // The position of the timer in sample frames
+}
+
+// CartChunk holds the fields of an AES46 cart chunk, which radio automation
+// systems read to schedule and segue the audio.
+type CartChunk struct {
+	Title          string // At most 64 characters
+	Artist         string // At most 64 characters
+	CutID          string // At most 64 characters
+	ClientID       string // At most 64 characters
+	Category       string // At most 64 characters
+	Classification string // At most 64 characters
+	OutCue         string // At most 64 characters
+
+	// StartTime and EndTime bound the period in which the audio may be
+	// played.  If they're zero, the defaults of 1900/01/01 00:00:00 and
+	// 9999/12/31 23:59:59 are written.
+	StartTime time.Time
+	EndTime   time.Time
+
+	ProducerAppID      string // At most 64 characters
+	ProducerAppVersion string // At most 64 characters
+	UserDef            string // At most 64 characters
+
+	// LevelReference is the sample value used as the 0 dB reference.
+	LevelReference int32
+
+	// Timers holds at most 8 timers.  Unused timers are written as zeros.
+	Timers []CartTimer
+
+	URL     string // At most 1024 characters
+	TagText string // Free text, one CR/LF-terminated line per entry
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// encode returns the body of the cart chunk.
+func (c *CartChunk) encode() ([]byte, error) {
+	var err error
+
+	if len(c.Timers) > 8 {
+		return nil, errors.New("A cart chunk holds at most 8 timers.")
+	}
+
+	buffer := new(bytes.Buffer)
+
+	// Version 1.01
+	buffer.WriteString("0101")
+
+	// Text fields
+	for _, field := range []string{
+		c.Title,
+		c.Artist,
+		c.CutID,
+		c.ClientID,
+		c.Category,
+		c.Classification,
+		c.OutCue,
+	} {
+		err = writeFixedString(buffer, field, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Start and end dates and times
+	start, end := c.StartTime, c.EndTime
+	if start.IsZero() {
+		start = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if end.IsZero() {
+		end = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+	}
+
+	for _, t := range []time.Time{start, end} {
+		buffer.WriteString(t.Format("2006/01/02"))
+		buffer.WriteString(t.Format("15:04:05"))
+	}
+
+	// Producer fields
+	for _, field := range []string{c.ProducerAppID, c.ProducerAppVersion, c.UserDef} {
+		err = writeFixedString(buffer, field, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Level reference
+	err = binary.Write(buffer, binary.LittleEndian, c.LevelReference)
+	if err != nil {
+		return nil, err
+	}
+
+	// Timers, each a four-character usage code followed by a sample offset
+	for i := 0; i < 8; i++ {
+		var timer CartTimer
+		if i < len(c.Timers) {
+			timer = c.Timers[i]
+		}
+
+		if timer.Usage != "" && len(timer.Usage) != 4 {
+			return nil, errors.New("The usage of a cart timer must be four characters long.")
+		}
+
+		err = writeFixedString(buffer, timer.Usage, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		err = binary.Write(buffer, binary.LittleEndian, timer.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Reserved
+	buffer.Write(make([]byte, 276))
+
+	// URL
+	err = writeFixedString(buffer, c.URL, 1024)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tag text
+	buffer.WriteString(c.TagText)
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// cuePoint is a labelled position in a file, added with AddCue.
+type cuePoint struct {
+	frame uint32
+	label string
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// newCuePoint checks that the frame fits in the 32-bit positions used by cue
+// and marker chunks.
+func newCuePoint(frame uint64, label string) (cuePoint, error) {
+	if frame > math.MaxUint32 {
+		return cuePoint{}, errors.New("Cue points must be within the first 2^32 frames.")
+	}
+
+	return cuePoint{frame: uint32(frame), label: label}, nil
+}
+
+// encodeWaveCues returns the body of the cue chunk and the body of the
+// LIST/adtl chunk holding the labels.  The second is nil if no cue point has
+// a label.  The cue points are numbered from 1 in the order they were added.
+func encodeWaveCues(cues []cuePoint) ([]byte, []byte, error) {
+	var err error
+
+	cue := new(bytes.Buffer)
+	err = binary.Write(cue, binary.LittleEndian, uint32(len(cues)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	adtl := new(bytes.Buffer)
+	adtl.WriteString("adtl")
+
+	labelled := false
+	for i, c := range cues {
+		id := uint32(i + 1)
+
+		// ID, play order position, chunk ID, chunk start, block start and
+		// sample offset.
+		err = binary.Write(cue, binary.LittleEndian, []uint32{id, c.frame})
+		if err != nil {
+			return nil, nil, err
+		}
+		cue.WriteString("data")
+		err = binary.Write(cue, binary.LittleEndian, []uint32{0, 0, c.frame})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if c.label == "" {
+			continue
+		}
+		labelled = true
+
+		// The labl chunk holds the ID followed by a null-terminated string.
+		text := append([]byte(c.label), 0)
+		adtl.WriteString("labl")
+		err = binary.Write(adtl, binary.LittleEndian, []uint32{uint32(4 + len(text)), id})
+		if err != nil {
+			return nil, nil, err
+		}
+		adtl.Write(text)
+		if len(text)%2 == 1 {
+			adtl.WriteByte(0)
+		}
+	}
+
+	if !labelled {
+		return cue.Bytes(), nil, nil
+	}
+	return cue.Bytes(), adtl.Bytes(), nil
+}
+
+// encodeAiffMarkers returns the body of the MARK chunk.  The markers are
+// numbered from 1 in the order they were added.
+func encodeAiffMarkers(cues []cuePoint) ([]byte, error) {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	err = binary.Write(buffer, binary.BigEndian, uint16(len(cues)))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range cues {
+		err = binary.Write(buffer, binary.BigEndian, int16(i+1))
+		if err != nil {
+			return nil, err
+		}
+
+		err = binary.Write(buffer, binary.BigEndian, c.frame)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(pascalString(c.label))
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package audioExport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeWaveCues(t *testing.T) {
+	cues := []cuePoint{{frame: 100}, {frame: 0x10000, label: "B"}}
+
+	cue, adtl, err := encodeWaveCues(cues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCue := []byte{
+		0x02, 0x00, 0x00, 0x00, // Number of cue points
+		0x01, 0x00, 0x00, 0x00, 0x64, 0x00, 0x00, 0x00, 'd', 'a', 't', 'a',
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x64, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 'd', 'a', 't', 'a',
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00,
+	}
+	if !bytes.Equal(cue, wantCue) {
+		t.Errorf("got cue % x, want % x", cue, wantCue)
+	}
+
+	wantAdtl := []byte{
+		'a', 'd', 't', 'l',
+		'l', 'a', 'b', 'l', 0x06, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 'B', 0x00,
+	}
+	if !bytes.Equal(adtl, wantAdtl) {
+		t.Errorf("got adtl % x, want % x", adtl, wantAdtl)
+	}
+}
+
+func TestEncodeWaveCuesWithoutLabels(t *testing.T) {
+	_, adtl, err := encodeWaveCues([]cuePoint{{frame: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if adtl != nil {
+		t.Errorf("got adtl % x for cue points without labels, want nil", adtl)
+	}
+}
+
+func TestEncodeAiffMarkers(t *testing.T) {
+	marks, err := encodeAiffMarkers([]cuePoint{{frame: 0x0102, label: "A"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0x00, 0x01, // Number of markers
+		0x00, 0x01, // ID
+		0x00, 0x00, 0x01, 0x02, // Position
+		0x01, 'A', // Name
+	}
+	if !bytes.Equal(marks, want) {
+		t.Errorf("got % x, want % x", marks, want)
+	}
+}
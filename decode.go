@@ -0,0 +1,101 @@
+package audioExport
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// readChunkHeader reads the ID and size of the next chunk.  It returns io.EOF
+// if there are no more chunks.
+func readChunkHeader(r io.Reader, order binary.ByteOrder) (string, uint32, error) {
+	header := make([]byte, 8)
+	n, err := io.ReadFull(r, header)
+	if n == 0 && err == io.EOF {
+		return "", 0, io.EOF
+	}
+	if err != nil {
+		return "", 0, errors.New("The file ends in the middle of a chunk header.")
+	}
+
+	return string(header[0:4]), order.Uint32(header[4:8]), nil
+}
+
+// readChunkBody reads the body of a chunk with the given declared size.
+// remaining is the number of bytes left in the file after the chunk header,
+// or -1 if it isn't known.  The body is read incrementally, so a corrupt size
+// can't cause a large allocation without the data to back it.
+func readChunkBody(r io.Reader, size uint32, remaining int64) ([]byte, error) {
+	if remaining >= 0 && int64(size) > remaining {
+		return nil, errors.New("The chunk size exceeds the remaining file size.")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) < int(size) {
+		return nil, errors.New("The file ends in the middle of a chunk.")
+	}
+
+	return body, nil
+}
+
+// decodeSamples demuxes the PCM samples of a data chunk.  8-bit samples are
+// unsigned unless signed8 is set, as is the case for AIFF.
+func decodeSamples(body []byte, desc AudioDescription, order binary.ByteOrder, signed8 bool) [][]float64 {
+	sampleSize := int(desc.containerBits()) / 8
+	frameSize := int(desc.NumChannels) * sampleSize
+	numFrames := len(body) / frameSize
+
+	channels := make([][]float64, desc.NumChannels)
+	for i := range channels {
+		channels[i] = make([]float64, numFrames)
+	}
+
+	for i := 0; i < numFrames; i++ {
+		for j := range channels {
+			sample := body[i*frameSize+j*sampleSize:]
+			if desc.isFloat() {
+				channels[j][i] = decodeFloatSample(sample, desc.containerBits(), order)
+			} else {
+				channels[j][i] = decodeSample(sample, desc.containerBits(), order, signed8)
+			}
+		}
+	}
+
+	return channels
+}
+
+// decodeSample converts a single PCM sample to a float.
+func decodeSample(sample []byte, bitsPerSample int16, order binary.ByteOrder, signed8 bool) float64 {
+	switch bitsPerSample {
+	case BPS8:
+		if signed8 {
+			return SampleToFloat(int32(int8(sample[0])), BPS8)
+		}
+		return float64(sample[0])/127.5 - 1
+	case BPS16:
+		return SampleToFloat(int32(int16(order.Uint16(sample))), BPS16)
+	case BPS24:
+		var res int32
+		if order == binary.BigEndian {
+			res = int32(int8(sample[0]))<<16 | int32(sample[1])<<8 | int32(sample[2])
+		} else {
+			res = int32(int8(sample[2]))<<16 | int32(sample[1])<<8 | int32(sample[0])
+		}
+		return SampleToFloat(res, BPS24)
+	default:
+		return SampleToFloat(int32(order.Uint32(sample)), BPS32)
+	}
+}
+
+// decodeFloatSample converts a 32- or 64-bit IEEE floating-point sample.
+func decodeFloatSample(sample []byte, bitsPerSample int16, order binary.ByteOrder) float64 {
+	if bitsPerSample == BPS64 {
+		return math.Float64frombits(order.Uint64(sample))
+	}
+	return float64(math.Float32frombits(order.Uint32(sample)))
+}
@@ -0,0 +1,54 @@
+package audioExport
+
+import (
+	"math"
+)
+
+// effectiveBitsTolerance is how far from an integer a scaled sample may be
+// and still count as lying on the grid of a bit depth, which absorbs the
+// rounding of the conversion to float.
+const effectiveBitsTolerance = 1e-4
+
+// EffectiveBitDepth estimates how many bits of resolution the channel uses,
+// such as 16 for 16-bit content held in floats, by finding the coarsest
+// integer grid that every sample lies on.  Both the symmetric scale used by
+// this package, where 1.0 is the largest sample, and the common scale where
+// -1.0 is the most negative sample are recognized.  It returns 0 for a
+// silent or empty channel, and 32 if the samples don't lie on the grid of
+// any depth up to 32 bits, as with synthesized float data.
+func EffectiveBitDepth(channel []float64) int {
+	silent := true
+	for _, x := range channel {
+		if x != 0 {
+			silent = false
+			break
+		}
+	}
+	if silent {
+		return 0
+	}
+
+	for bits := 2; bits <= 32; bits++ {
+		half := float64(int64(1) << uint(bits-1))
+		if onGrid(channel, half-1) || onGrid(channel, half) {
+			return bits
+		}
+	}
+
+	return 32
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// onGrid returns whether every sample is an integer multiple of 1/scale.
+func onGrid(channel []float64, scale float64) bool {
+	for _, x := range channel {
+		v := x * scale
+		if math.Abs(v-math.Round(v)) > effectiveBitsTolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package audioExport
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// DitherMode selects the dither added to samples given as floats before
+// they're quantized to an integer bit depth.
+type DitherMode int
+
+// The DitherMode constants list the possible values for the Dither option of
+// WaveFile and AiffFile.
+const (
+	DitherNone DitherMode = iota
+
+	// DitherTPDF adds flat triangular dither of plus or minus one least
+	// significant bit, which decorrelates the quantization error from the
+	// signal.
+	DitherTPDF
+
+	// DitherNoiseShaped adds the same dither but feeds the quantization error
+	// back through a 9th-order filter, which moves the noise out of the
+	// midrange where hearing is most sensitive and into the top octave.
+	// The curve is designed for 44.1 and 48kHz; at much higher rates, the
+	// noise stays below 20kHz and TPDF is the better choice.
+	DitherNoiseShaped
+)
+
+// ditherSeed seeds the dither noise, so that rendering the same channels
+// twice produces identical files.
+const ditherSeed = 1
+
+// noiseShapingFilter holds the error feedback coefficients of the 9th-order
+// E-weighted curve of Wannamaker, which follows the inverse of the ear's
+// threshold of hearing at 44.1kHz.
+var noiseShapingFilter = [...]float64{2.412, -3.370, 3.937, -4.174, 3.353, -2.205, 1.281, -0.569, 0.0847}
+
+// noiseShapingLimit bounds the quantization error fed back, in least
+// significant bits, so that clipped samples can't make the filter unstable.
+const noiseShapingLimit = 4
+
+// ditherer adds triangular (TPDF) dither to samples before they're quantized
+// to a lower bit depth.  The noise spans plus or minus one least significant
+// bit at the target depth, which decorrelates the quantization error from
+// the signal.
+type ditherer struct {
+	lsb  float64
+	rand *rand.Rand
+
+	// The fields below are only used for noise shaping.  errors holds the
+	// recent quantization errors of each channel, newest first.
+	bits      int16
+	unsigned8 bool
+	errors    [][len(noiseShapingFilter)]float64
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// newDitherer returns a ditherer for samples quantized to the given number of
+// bits.
+func newDitherer(bits int16) *ditherer {
+	return &ditherer{
+		lsb:  1 / float64(int64(1)<<uint(bits-1)-1),
+		rand: rand.New(rand.NewSource(ditherSeed)),
+	}
+}
+
+// newShapedDitherer returns a ditherer with noise shaping for the channels of
+// the description, which must have an integer format.  unsigned8 gives
+// whether 8-bit samples are stored unsigned, which sets the quantization
+// grid.
+func newShapedDitherer(desc AudioDescription, unsigned8 bool) (*ditherer, error) {
+	if desc.NumChannels <= 0 {
+		return nil, errors.New("The description must have at least one channel.")
+	}
+
+	d := newDitherer(desc.validBits())
+	d.bits = desc.validBits()
+	d.unsigned8 = unsigned8 && desc.containerBits() == BPS8
+	d.errors = make([][len(noiseShapingFilter)]float64, desc.NumChannels)
+	return d, nil
+}
+
+// newWriterDitherer returns the ditherer for the Dither option of a file, or
+// nil if no dither is added.
+func newWriterDitherer(mode DitherMode, desc AudioDescription, unsigned8 bool) (*ditherer, error) {
+	if desc.isFloat() {
+		return nil, nil
+	}
+
+	switch mode {
+	case DitherTPDF:
+		return newDitherer(desc.validBits()), nil
+	case DitherNoiseShaped:
+		return newShapedDitherer(desc, unsigned8)
+	default:
+		return nil, nil
+	}
+}
+
+// process returns the sample of the given channel ready to be quantized,
+// with dither added and, when noise shaping, the past errors subtracted.
+func (d *ditherer) process(data float64, channel int) float64 {
+	if d.errors == nil {
+		return d.apply(data)
+	}
+
+	history := &d.errors[channel]
+	shaped := data
+	for k, c := range noiseShapingFilter {
+		shaped -= c * history[k]
+	}
+
+	// The sample is quantized here so that its error can be fed back.  It
+	// then lies on the grid, so encoding it again doesn't change it.
+	quantized := d.quantize(d.apply(shaped))
+
+	limit := noiseShapingLimit * d.lsb
+	err := math.Max(-limit, math.Min(limit, quantized-shaped))
+	copy(history[1:], history[:len(history)-1])
+	history[0] = err
+
+	return quantized
+}
+
+// quantize rounds the sample to the grid of the bit depth as it's encoded.
+func (d *ditherer) quantize(data float64) float64 {
+	if d.unsigned8 {
+		res := math.Max(0, math.Min(math.MaxUint8, math.Round((data+1)*127.5)))
+		return res/127.5 - 1
+	}
+
+	return SampleToFloat(FloatToSample(data, d.bits), d.bits)
+}
+
+// apply returns the sample with dither added.
+func (d *ditherer) apply(data float64) float64 {
+	return data + (d.rand.Float64()-d.rand.Float64())*d.lsb
+}
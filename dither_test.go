@@ -0,0 +1,32 @@
+package audioExport
+
+import (
+	"testing"
+)
+
+func TestNewShapedDithererRejectsNoChannels(t *testing.T) {
+	for _, channels := range []int16{0, -1} {
+		description := AudioDescription{NumChannels: channels, SampleRate: 48000, BitsPerSample: 16}
+
+		_, err := newShapedDitherer(description, false)
+		if err == nil {
+			t.Errorf("newShapedDitherer succeeded with %d channels", channels)
+		}
+	}
+}
+
+func TestNewShapedDitherer(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 8}
+
+	d, err := newShapedDitherer(description, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.errors) != 2 {
+		t.Errorf("got error state for %d channels, want 2", len(d.errors))
+	}
+	if !d.unsigned8 {
+		t.Error("8-bit samples aren't quantized as unsigned")
+	}
+}
@@ -0,0 +1,224 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// EncodeChannels muxes the channels and encodes them as the PCM bytes of a WAV
+// data chunk in the format of the description, without writing them
+// anywhere.  It's meant for callers that manage their own I/O.  Each channel
+// should be a float64 slice where each item ranges from -1 to 1; values
+// beyond these bounds are clipped.  The options of a WaveFile, such as its
+// channel gains, aren't applied.
+func EncodeChannels(desc AudioDescription, channels ...[]float64) ([]byte, error) {
+	err := checkChannels(desc, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	if isStereo16(desc) {
+		return encodeStereo16(channels[0], channels[1], binary.LittleEndian), nil
+	}
+
+	return encodeChannels(channels, func(data float64, channel, frame int, buffer *bytes.Buffer) error {
+		return encodeSample(data, desc, binary.LittleEndian, false, buffer)
+	})
+}
+
+// WaveHeader returns the headers that a WaveFile writes for the description,
+// with the chunk sizes filled in for dataSize bytes of sound data.  Together
+// with EncodeChannels, it lets a complete WAV file be assembled in memory.
+func WaveHeader(desc AudioDescription, dataSize uint32) ([]byte, error) {
+	var err error
+
+	var w WaveFile
+	err = w.reset(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	err = w.writeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+	header := buffer.Bytes()
+	w.fillSizes(header, dataSize)
+
+	return header, nil
+}
+
+// AiffHeader returns the headers that an AiffFile writes for the description,
+// with the chunk sizes filled in for dataSize bytes of sound data.  The sound
+// data should be encoded as big-endian, signed samples, and float
+// descriptions get an AIFC header.  If dataSize is odd, the data must be
+// followed by a pad byte, which the size of the FORM chunk accounts for.
+func AiffHeader(desc AudioDescription, dataSize uint32) ([]byte, error) {
+	var err error
+
+	a := AiffFile{FloatAIFC: true}
+	err = a.reset(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	err = a.writeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+	header := buffer.Bytes()
+	a.fillSizes(header, dataSize, 0)
+
+	return header, nil
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// checkChannels makes sure there's one channel for each channel of the
+// description and that they all have the same length.  It's used for both
+// float and integer channels.
+func checkChannels[T float64 | int32](desc AudioDescription, channels [][]T) error {
+	// If too many channels are given, return an error.
+	if len(channels) != int(desc.NumChannels) {
+		return &ChannelCountError{Expected: int(desc.NumChannels), Actual: len(channels)}
+	}
+
+	// Make sure the data streams are all of the same length
+	for i := range channels {
+		if len(channels[i]) != len(channels[0]) {
+			return errors.New("The channels have different amounts of audio data.")
+		}
+	}
+
+	return nil
+}
+
+// encodeChannels muxes the channels, passing each sample to encode along with
+// its channel and frame index.  The channels must already have been checked
+// with checkChannels.
+func encodeChannels(channels [][]float64, encode func(data float64, channel, frame int, buffer *bytes.Buffer) error) ([]byte, error) {
+	var err error
+
+	if len(channels) == 0 {
+		return nil, nil
+	}
+
+	buffer := new(bytes.Buffer)
+
+	// Write to the buffer
+	for i := 0; i < len(channels[0]); i++ {
+		for j := range channels {
+			err = encode(channels[j][i], j, i, buffer)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// isStereo16 returns whether the description is 16-bit integer stereo, the
+// most common format, which has a fast path in encodeStereo16.
+func isStereo16(desc AudioDescription) bool {
+	return desc.NumChannels == 2 && !desc.isFloat() &&
+		desc.containerBits() == BPS16 && desc.validBits() == BPS16
+}
+
+// encodeStereo16 muxes and encodes a pair of channels as 16-bit samples.  It
+// produces the same bytes as encodeChannels with encodeSample, but it writes
+// directly into a preallocated slice in a tight loop.
+func encodeStereo16(left, right []float64, order binary.ByteOrder) []byte {
+	res := make([]byte, 4*len(left))
+	for i, j := 0, 0; i < len(left); i, j = i+1, j+4 {
+		order.PutUint16(res[j:], uint16(quantize(left[i], BPS16)))
+		order.PutUint16(res[j+2:], uint16(quantize(right[i], BPS16)))
+	}
+	return res
+}
+
+// encodeSample writes a sample to the buffer at the bit depth of the
+// description.  Integer samples are quantized to the valid bits and
+// left-justified in their container.  8-bit samples are unsigned unless
+// signed8Bit is set, as is the case for AIFF.
+func encodeSample(data float64, desc AudioDescription, order binary.ByteOrder, signed8Bit bool, buffer *bytes.Buffer) error {
+	if desc.isFloat() {
+		return encodeFloatSample(data, desc.containerBits(), order, buffer)
+	}
+
+	switch desc.containerBits() {
+	case BPS8:
+		if !signed8Bit {
+			return encodeUnsigned8Bit(data, buffer)
+		}
+	case BPS16, BPS24, BPS32:
+	default:
+		return errors.New("Invalid bit depth.")
+	}
+
+	valid := desc.validBits()
+	return encodeInt32(quantize(data, valid)<<uint(32-valid), desc, order, buffer)
+}
+
+// encodeUnsigned8Bit writes an 8-bit unsigned integer to the buffer.  The
+// range -1.0 to 1.0 maps onto 0 to 255, so silence rounds to the midpoint of
+// 128.
+func encodeUnsigned8Bit(data float64, buffer *bytes.Buffer) error {
+	res := math.Round((data + 1) * 127.5)
+	if res < 0 {
+		res = 0
+	} else if res > math.MaxUint8 {
+		res = math.MaxUint8
+	}
+
+	return buffer.WriteByte(uint8(res))
+}
+
+// encodeFloatSample writes a 32- or 64-bit IEEE floating-point sample to the
+// buffer without quantizing or clamping it.
+func encodeFloatSample(data float64, bitsPerSample int16, order binary.ByteOrder, buffer *bytes.Buffer) error {
+	var b [8]byte
+
+	switch bitsPerSample {
+	case BPS32:
+		order.PutUint32(b[:], math.Float32bits(float32(data)))
+		_, err := buffer.Write(b[:4])
+		return err
+	case BPS64:
+		order.PutUint64(b[:], math.Float64bits(data))
+		_, err := buffer.Write(b[:])
+		return err
+	default:
+		return errors.New("Invalid bit depth.")
+	}
+}
+
+// encodeInt32 writes a left-justified 32-bit sample to the buffer using the
+// most significant bytes that fit in the container.  Any bits beyond the
+// valid bits of the description are cleared.
+func encodeInt32(res int32, desc AudioDescription, order binary.ByteOrder, buffer *bytes.Buffer) error {
+	res &^= int32(1)<<uint(32-desc.validBits()) - 1
+
+	size := int(desc.containerBits()) / 8
+	if size < 1 || size > 4 || desc.containerBits()%8 != 0 {
+		return errors.New("Invalid bit depth.")
+	}
+
+	var b [4]byte
+	order.PutUint32(b[:], uint32(res))
+
+	// The least significant bytes are dropped, which come last in big-endian
+	// order and first in little-endian order.
+	if order == binary.BigEndian {
+		_, err := buffer.Write(b[:size])
+		return err
+	}
+	_, err := buffer.Write(b[4-size:])
+	return err
+}
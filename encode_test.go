@@ -0,0 +1,215 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeUnsigned8Bit(t *testing.T) {
+	tests := []struct {
+		data float64
+		want byte
+	}{
+		{-1, 0},
+		{1, 255},
+		{0.5, 191},
+		{-0.5, 64},
+
+		// Silence falls halfway between 127 and 128 and rounds up.
+		{0, 128},
+
+		// Out-of-range samples are clamped.
+		{1.5, 255},
+		{-1.5, 0},
+		{100, 255},
+		{-100, 0},
+	}
+
+	for _, test := range tests {
+		buffer := new(bytes.Buffer)
+		err := encodeUnsigned8Bit(test.data, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := buffer.Bytes(); len(got) != 1 || got[0] != test.want {
+			t.Errorf("encodeUnsigned8Bit(%v) = % x, want %02x", test.data, got, test.want)
+		}
+	}
+}
+
+// headerTestDescriptions are the descriptions whose headers are compared with
+// the files that are actually written.
+var headerTestDescriptions = []AudioDescription{
+	{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16},
+	{NumChannels: 1, SampleRate: 48000, BitsPerSample: 8},
+	{NumChannels: 1, SampleRate: 96000, BitsPerSample: 24},
+	{NumChannels: 2, SampleRate: 48000, BitsPerSample: 20, ContainerBits: 24},
+	{NumChannels: 6, SampleRate: 48000, BitsPerSample: 24},
+	{NumChannels: 2, SampleRate: 48000, BitsPerSample: 32, Format: FormatIEEEFloat},
+	{NumChannels: 1, SampleRate: 22050, BitsPerSample: 64, Format: FormatIEEEFloat},
+}
+
+// writeHeaderTestFile writes three frames of silence with the file and
+// returns the contents of the file.
+func writeHeaderTestFile(t *testing.T, file AudioFile, name string, description AudioDescription) []byte {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), name)
+	err := file.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channels := make([][]float64, description.NumChannels)
+	for i := range channels {
+		channels[i] = make([]float64, 3)
+	}
+
+	err = file.WriteChannels(channels...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return contents
+}
+
+func TestEncodeInt32(t *testing.T) {
+	tests := []struct {
+		bits  int16
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{BPS16, binary.LittleEndian, []byte{0x34, 0x12}},
+		{BPS16, binary.BigEndian, []byte{0x12, 0x34}},
+		{BPS24, binary.LittleEndian, []byte{0x56, 0x34, 0x12}},
+		{BPS24, binary.BigEndian, []byte{0x12, 0x34, 0x56}},
+		{BPS32, binary.LittleEndian, []byte{0x78, 0x56, 0x34, 0x12}},
+		{BPS32, binary.BigEndian, []byte{0x12, 0x34, 0x56, 0x78}},
+	}
+
+	for _, test := range tests {
+		desc := AudioDescription{NumChannels: 1, SampleRate: 48000, BitsPerSample: test.bits}
+		buffer := new(bytes.Buffer)
+		err := encodeInt32(0x12345678, desc, test.order, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := buffer.Bytes(); !bytes.Equal(got, test.want) {
+			t.Errorf("encodeInt32 at %d bits in %v = % x, want % x", test.bits, test.order, got, test.want)
+		}
+	}
+}
+
+func TestWaveHeaderMatchesWaveFile(t *testing.T) {
+	for _, description := range headerTestDescriptions {
+		contents := writeHeaderTestFile(t, new(WaveFile), "out.wav", description)
+		dataSize := 3 * uint32(description.NumChannels) * uint32(description.containerBits()) / 8
+
+		header, err := WaveHeader(description, dataSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(contents) < len(header) || !bytes.Equal(contents[:len(header)], header) {
+			t.Errorf("%+v: WaveHeader doesn't match the file:\nheader % x\n  file % x", description, header, contents[:min(len(header), len(contents))])
+		}
+	}
+}
+
+func TestAiffHeaderMatchesAiffFile(t *testing.T) {
+	for _, description := range headerTestDescriptions {
+		contents := writeHeaderTestFile(t, &AiffFile{FloatAIFC: true}, "out.aiff", description)
+		dataSize := 3 * uint32(description.NumChannels) * uint32(description.containerBits()) / 8
+
+		header, err := AiffHeader(description, dataSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(contents) < len(header) || !bytes.Equal(contents[:len(header)], header) {
+			t.Errorf("%+v: AiffHeader doesn't match the file:\nheader % x\n  file % x", description, header, contents[:min(len(header), len(contents))])
+		}
+	}
+}
+
+func TestWaveHeaderGolden(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16}
+
+	header, err := WaveHeader(description, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		'R', 'I', 'F', 'F', 0xb4, 0x01, 0x00, 0x00, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 0x10, 0x00, 0x00, 0x00,
+		0x01, 0x00, // PCM
+		0x02, 0x00, // Channels
+		0x44, 0xac, 0x00, 0x00, // Sample rate
+		0x10, 0xb1, 0x02, 0x00, // Byte rate
+		0x04, 0x00, // Block align
+		0x10, 0x00, // Bits per sample
+		'd', 'a', 't', 'a', 0x90, 0x01, 0x00, 0x00,
+	}
+	if !bytes.Equal(header, want) {
+		t.Errorf("got % x, want % x", header, want)
+	}
+}
+
+func TestAiffHeaderGolden(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	header, err := AiffHeader(description, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		'F', 'O', 'R', 'M', 0x00, 0x00, 0x00, 0xf6, 'A', 'I', 'F', 'F',
+		'C', 'O', 'M', 'M', 0x00, 0x00, 0x00, 0x12,
+		0x00, 0x01, // Channels
+		0x00, 0x00, 0x00, 0x64, // Frames
+		0x00, 0x10, // Bits per sample
+		0x40, 0x0e, 0xac, 0x44, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 44100 Hz
+		'S', 'S', 'N', 'D', 0x00, 0x00, 0x00, 0xd0,
+		0x00, 0x00, 0x00, 0x00, // Offset
+		0x00, 0x00, 0x00, 0x00, // Block size
+	}
+	if !bytes.Equal(header, want) {
+		t.Errorf("got % x, want % x", header, want)
+	}
+}
+
+func TestEncodeStereo16MatchesEncodeSample(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16}
+	left := []float64{-1.5, -1, -0.5, -1.0 / 65534, 0, 1.0 / 65534, 0.5, 1, 1.5}
+	right := []float64{1, 0.75, 0.25, 0, 0, 0, -0.25, -0.75, -1}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		want, err := encodeChannels([][]float64{left, right}, func(data float64, channel, frame int, buffer *bytes.Buffer) error {
+			return encodeSample(data, description, order, true, buffer)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := encodeStereo16(left, right, order); !bytes.Equal(got, want) {
+			t.Errorf("%v: got % x, want % x", order, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package audioExport
+
+import (
+	"sort"
+	"time"
+)
+
+// Breakpoint is a point of a gain envelope given to ApplyEnvelope.
+type Breakpoint struct {
+	Time time.Duration // The time from the start of the channel
+	Gain float64       // The linear gain at that time, e.g. from DBToLinear
+}
+
+// WriteEnvelope writes a control envelope, such as automation data, to a mono
+// .wav file.  The values are stored as 32-bit IEEE floats so that they survive
+// a round trip without integer quantization.
+func WriteEnvelope(name string, rate uint32, values []float64) error {
+	desc := AudioDescription{
+		NumChannels:   1,
+		SampleRate:    rate,
+		BitsPerSample: BPS32,
+		Format:        FormatIEEEFloat,
+	}
+
+	return writeWaveFile(name, desc, values)
+}
+
+// ApplyEnvelope multiplies the channel, sampled at rate, by a gain that's
+// linearly interpolated between the breakpoints and returns the result.  The
+// gain holds at the first breakpoint's before it and at the last one's after
+// it.  The breakpoints don't need to be sorted by time.  Without breakpoints,
+// the channel is copied unchanged.
+func ApplyEnvelope(channel []float64, breakpoints []Breakpoint, rate uint32) []float64 {
+	res := make([]float64, len(channel))
+	if len(breakpoints) == 0 {
+		copy(res, channel)
+		return res
+	}
+
+	points := append([]Breakpoint(nil), breakpoints...)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time < points[j].Time
+	})
+
+	// The breakpoints are converted to fractional frames so that they don't
+	// need to land on a sample.
+	frameOf := func(p Breakpoint) float64 {
+		return p.Time.Seconds() * float64(rate)
+	}
+
+	next := 0
+	for i := range channel {
+		t := float64(i)
+		for next < len(points) && frameOf(points[next]) <= t {
+			next++
+		}
+
+		var gain float64
+		switch next {
+		case 0:
+			gain = points[0].Gain
+		case len(points):
+			gain = points[len(points)-1].Gain
+		default:
+			a, b := points[next-1], points[next]
+			start, end := frameOf(a), frameOf(b)
+			gain = a.Gain + (b.Gain-a.Gain)*(t-start)/(end-start)
+		}
+
+		res[i] = channel[i] * gain
+	}
+
+	return res
+}
@@ -0,0 +1,178 @@
+package audioExport
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// FileFormat identifies one of the supported file formats.
+type FileFormat int
+
+// The FileFormat constants list the file formats that can be written.
+const (
+	FormatWave FileFormat = iota
+	FormatAiff
+)
+
+// Feature identifies an optional capability of a file format, such as a kind
+// of metadata, for use with Supports.
+type Feature int
+
+// The Feature constants list the capabilities that Supports knows about.
+const (
+	FeatureFloat            Feature = iota // IEEE floating-point samples
+	FeatureCues                            // Cue points or markers, set with AddCue
+	FeatureLoops                           // Loop points
+	FeatureBext                            // Broadcast Wave bext chunks
+	FeatureCart                            // AES46 cart chunks
+	FeatureAcid                            // acid chunks with tempo metadata
+	FeatureID3                             // ID3v2 tags and album art
+	FeatureAESChannelStatus                // AES channel status data
+	FeatureCustomChunks                    // Arbitrary chunks, set with SetChunks
+	FeatureStreaming                       // Writing to an io.Writer
+	FeatureAppend                          // Appending to an existing file
+)
+
+// Supports returns whether files in the given format can be written with the
+// feature, e.g. to hide options that don't apply to the selected format.  It
+// returns false for unknown formats and features.
+func Supports(format FileFormat, feature Feature) bool {
+	switch format {
+	case FormatWave:
+		switch feature {
+		case FeatureFloat, FeatureCues, FeatureLoops, FeatureBext, FeatureCart, FeatureAcid,
+			FeatureID3, FeatureCustomChunks, FeatureStreaming, FeatureAppend:
+			return true
+		}
+	case FormatAiff:
+		switch feature {
+		case FeatureFloat, FeatureCues, FeatureLoops, FeatureID3, FeatureAESChannelStatus:
+			return true
+		}
+	}
+
+	return false
+}
+
+// SupportedBitDepths returns the values of BitsPerSample that can be written
+// in the given format.  Integer samples can have 8, 16, 24 or 32 bits, or 20
+// bits in 24-bit containers, as set with ContainerBits.  Floating-point
+// samples can have 32 or 64 bits, which AIFF files only store when AIFC or
+// FloatAIFC is set.
+func SupportedBitDepths(format FileFormat) []int16 {
+	switch format {
+	case FormatWave, FormatAiff:
+		return []int16{BPS8, BPS16, 20, BPS24, BPS32, BPS64}
+	default:
+		return nil
+	}
+}
+
+// FileExtensions returns the file name extensions used for the given format,
+// with the most common first.
+func FileExtensions(format FileFormat) []string {
+	switch format {
+	case FormatWave:
+		return []string{".wav", ".wave"}
+	case FormatAiff:
+		return []string{".aiff", ".aif", ".aifc"}
+	default:
+		return nil
+	}
+}
+
+// SupportedSampleRates returns the sample rates that can be written in the
+// given format.  It returns nil if the format accepts any sample rate, which
+// is currently the case for every format.
+func SupportedSampleRates(format FileFormat) []uint32 {
+	return nil
+}
+
+// MaxFileSize returns the largest size in bytes that a file in the given
+// format can reach, which is the limit of its chunk size fields.  WAV sizes
+// are unsigned 32-bit integers, so files can reach 4GB, while AIFF sizes are
+// signed, which halves the limit to 2GB.  The limit covers the whole file,
+// headers included, so the sample data must be slightly smaller; use
+// EstimateFileSize to check a given number of frames.  It returns 0 for an
+// unknown format.
+func MaxFileSize(format FileFormat) int64 {
+	switch format {
+	case FormatWave:
+		return math.MaxUint32
+	case FormatAiff:
+		return math.MaxInt32
+	default:
+		return 0
+	}
+}
+
+// EstimateFileSize returns the size in bytes of a file in the given format
+// holding the given number of frames, when it's written with the default
+// options and no metadata.
+func EstimateFileSize(format FileFormat, description AudioDescription, frames uint64) (int64, error) {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	dataSize := int64(frames) * int64(description.NumChannels) * int64(description.containerBits()/8)
+
+	switch format {
+	case FormatWave:
+		var w WaveFile
+		err = w.reset(description)
+		if err != nil {
+			return 0, err
+		}
+		err = w.writeHeader(buffer)
+	case FormatAiff:
+		a := AiffFile{FloatAIFC: true}
+		err = a.reset(description)
+		if err != nil {
+			return 0, err
+		}
+		err = a.writeHeader(buffer)
+
+		// The sound data is followed by a pad byte if it has an odd length.
+		dataSize += dataSize % 2
+	default:
+		return 0, errors.New("Unknown file format.")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(buffer.Len()) + dataSize, nil
+}
+
+// checkExtension returns an error if the extension of fileName, ignoring case,
+// isn't one of the given extensions.
+func checkExtension(fileName string, extensions ...string) error {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, e := range extensions {
+		if ext == e {
+			return nil
+		}
+	}
+
+	return errors.New("The file extension doesn't match the format; expected " + strings.Join(extensions, " or ") + ".")
+}
+
+// preallocatedSize returns the size of a file in the given format whose
+// headers take headerSize bytes once the given number of frames has been
+// written.  The size of the data, including any pad byte, is taken from
+// EstimateFileSize, while the headers, which may hold metadata, are measured.
+func preallocatedSize(format FileFormat, description AudioDescription, headerSize int64, frames uint64) (int64, error) {
+	empty, err := EstimateFileSize(format, description, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	full, err := EstimateFileSize(format, description, frames)
+	if err != nil {
+		return 0, err
+	}
+
+	return headerSize + full - empty, nil
+}
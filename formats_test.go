@@ -0,0 +1,74 @@
+package audioExport
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaxFileSize(t *testing.T) {
+	tests := []struct {
+		format FileFormat
+		want   int64
+	}{
+		{FormatWave, math.MaxUint32},
+		{FormatAiff, math.MaxInt32},
+		{FileFormat(-1), 0},
+	}
+
+	for _, test := range tests {
+		if got := MaxFileSize(test.format); got != test.want {
+			t.Errorf("MaxFileSize(%d) = %d, want %d", test.format, got, test.want)
+		}
+	}
+}
+
+// openForDepth opens a file of the given format with a description using the
+// bit depth, choosing a 24-bit container for 20 bits and floats for 64 bits.
+func openForDepth(t *testing.T, format FileFormat, bits int16) (AudioFile, error) {
+	t.Helper()
+
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: bits}
+	switch bits {
+	case 20:
+		description.ContainerBits = BPS24
+	case BPS64:
+		description.Format = FormatIEEEFloat
+	}
+
+	var file AudioFile
+	name := filepath.Join(t.TempDir(), "out")
+	switch format {
+	case FormatWave:
+		file = new(WaveFile)
+		name += ".wav"
+	case FormatAiff:
+		file = &AiffFile{FloatAIFC: true}
+		name += ".aiff"
+	}
+
+	err := file.Open(name, description)
+	return file, err
+}
+
+func TestSupportedBitDepths(t *testing.T) {
+	for _, format := range []FileFormat{FormatWave, FormatAiff} {
+		for _, bits := range SupportedBitDepths(format) {
+			file, err := openForDepth(t, format, bits)
+			if err != nil {
+				t.Errorf("format %d can't be opened with %d bits: %v", format, bits, err)
+				continue
+			}
+
+			err = file.WriteChannels([]float64{-1, 0, 1})
+			if err != nil {
+				t.Errorf("format %d can't be written with %d bits: %v", format, bits, err)
+			}
+
+			err = file.Close()
+			if err != nil {
+				t.Errorf("format %d can't be closed with %d bits: %v", format, bits, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package audioExport
+
+import (
+	"math"
+)
+
+// DBToLinear converts a gain in decibels to a linear amplitude factor, e.g.
+// -6 dB is roughly 0.5.
+func DBToLinear(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// LinearToDB converts a linear amplitude factor to a gain in decibels.  The
+// sign of the factor is ignored, and a factor of 0 returns negative infinity.
+func LinearToDB(linear float64) float64 {
+	return 20 * math.Log10(math.Abs(linear))
+}
+
+// Normalize linearly maps a channel whose samples range from min to max, such
+// as 0 to 65535 from an ADC, onto -1 to 1 and returns the result.  Samples
+// outside the range map beyond -1 or 1.  If min equals max, every sample maps
+// to 0.
+func Normalize(channel []float64, min, max float64) []float64 {
+	res := make([]float64, len(channel))
+	if min == max {
+		return res
+	}
+
+	scale := 2 / (max - min)
+	for i := range channel {
+		res[i] = (channel[i]-min)*scale - 1
+	}
+
+	return res
+}
+
+// TrimSilence removes the silent frames from the start and end of the
+// channels, returning the trimmed channels along with the number of frames
+// removed from the start and from the end.  A frame is silent if the samples
+// of every channel are no louder than thresholdDB, e.g. -60.  The trimmed
+// channels share memory with the originals.  If every frame is silent, the
+// channels are emptied and all of the frames count as removed from the start.
+func TrimSilence(channels [][]float64, thresholdDB float64) ([][]float64, int, int) {
+	if len(channels) == 0 {
+		return channels, 0, 0
+	}
+
+	threshold := DBToLinear(thresholdDB)
+	chanLength := len(channels[0])
+	for i := range channels {
+		if len(channels[i]) < chanLength {
+			chanLength = len(channels[i])
+		}
+	}
+
+	silent := func(frame int) bool {
+		for j := range channels {
+			if math.Abs(channels[j][frame]) > threshold {
+				return false
+			}
+		}
+		return true
+	}
+
+	start := 0
+	for start < chanLength && silent(start) {
+		start++
+	}
+
+	end := chanLength
+	for end > start && silent(end-1) {
+		end--
+	}
+
+	trimmed := make([][]float64, len(channels))
+	for j := range channels {
+		trimmed[j] = channels[j][start:end]
+	}
+
+	return trimmed, start, chanLength - end
+}
@@ -0,0 +1,194 @@
+package audioExport
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// The click constants shape each click of a ClickTrack: a short sine burst
+// with an exponential decay.  Accented clicks are higher and louder.
+const (
+	clickLength      = 0.02  // The length of a click in seconds
+	clickDecay       = 0.003 // The time constant of the decay in seconds
+	clickFrequency   = 1000.0
+	clickLevel       = 0.5
+	accentFrequency  = 1500.0
+	accentClickLevel = 0.9
+)
+
+// toneLevelDB is the level of the tone written by WriteToneFile, the EBU R68
+// alignment level.
+const toneLevelDB = -18
+
+// pinkNoiseRows is the number of random sources summed by PinkNoise.  Each one
+// covers an octave, so 16 rows give a 1/f spectrum down to a few Hz at common
+// sample rates.
+const pinkNoiseRows = 16
+
+// ClickTrack returns a mono metronome track with the given number of beats at
+// the given tempo, ready to pass to WriteChannels.  Each beat is a 20ms sine
+// burst that decays quickly.  If accentFirst is set, the first beat, such as
+// beat one of a bar, is higher and louder than the others.  The track ends
+// one beat after the last click.  It returns nil if the tempo, number of
+// beats or sample rate isn't positive.
+func ClickTrack(bpm float64, beats int, sampleRate uint32, accentFirst bool) []float64 {
+	if !(bpm > 0) || beats <= 0 || sampleRate == 0 {
+		return nil
+	}
+
+	rate := float64(sampleRate)
+	beatLength := 60 / bpm * rate
+	track := make([]float64, int(math.Round(float64(beats)*beatLength)))
+
+	for beat := 0; beat < beats; beat++ {
+		frequency, level := clickFrequency, clickLevel
+		if accentFirst && beat == 0 {
+			frequency, level = accentFrequency, accentClickLevel
+		}
+
+		// Each click starts on the nearest frame to its beat, so the tempo
+		// doesn't drift when a beat isn't a whole number of frames.
+		start := int(math.Round(float64(beat) * beatLength))
+		for i := 0; i < int(clickLength*rate) && start+i < len(track); i++ {
+			t := float64(i) / rate
+			track[start+i] = level * math.Exp(-t/clickDecay) * math.Sin(2*math.Pi*frequency*t)
+		}
+	}
+
+	return track
+}
+
+// Sweep returns a mono sine sweep, or chirp, from startHz to endHz over the
+// given duration at full scale.  A logarithmic sweep spends the same time on
+// each octave, as used to measure frequency and impulse responses, while a
+// linear sweep changes frequency at a constant rate.  The phase is
+// continuous throughout.  It returns nil if the duration or sample rate isn't
+// positive, or if a frequency isn't positive for a logarithmic sweep.
+func Sweep(startHz, endHz, durationSeconds float64, sampleRate uint32, logarithmic bool) []float64 {
+	if !(durationSeconds > 0) || sampleRate == 0 {
+		return nil
+	}
+	if logarithmic && !(startHz > 0 && endHz > 0) {
+		return nil
+	}
+
+	rate := float64(sampleRate)
+	sweep := make([]float64, int(math.Round(durationSeconds*rate)))
+
+	// The phase is the integral of the instantaneous frequency.  For the
+	// exponential sweep, the frequency at time t is startHz*exp(t*k/T) with
+	// k = ln(endHz/startHz).
+	k := math.Log(endHz / startHz)
+	for i := range sweep {
+		t := float64(i) / rate
+
+		var phase float64
+		switch {
+		case logarithmic && k != 0:
+			phase = startHz * durationSeconds / k * (math.Exp(t*k/durationSeconds) - 1)
+		case logarithmic:
+			phase = startHz * t
+		default:
+			phase = startHz*t + (endHz-startHz)*t*t/(2*durationSeconds)
+		}
+
+		sweep[i] = math.Sin(2 * math.Pi * phase)
+	}
+
+	return sweep
+}
+
+// WhiteNoise returns n samples of white noise, uniformly distributed between
+// -1 and 1.  The same seed always produces the same noise.
+func WhiteNoise(n int, seed int64) []float64 {
+	if n <= 0 {
+		return nil
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	noise := make([]float64, n)
+	for i := range noise {
+		noise[i] = 2*random.Float64() - 1
+	}
+
+	return noise
+}
+
+// PinkNoise returns n samples of pink noise, whose power falls by 3dB per
+// octave, between -1 and 1.  It uses the Voss-McCartney algorithm, which sums
+// random sources that are each updated half as often as the one before.  The
+// same seed always produces the same noise.
+func PinkNoise(n int, seed int64) []float64 {
+	if n <= 0 {
+		return nil
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	var rows [pinkNoiseRows]float64
+	var sum float64
+	for i := range rows {
+		rows[i] = 2*random.Float64() - 1
+		sum += rows[i]
+	}
+
+	noise := make([]float64, n)
+	for i := range noise {
+		// Only the row given by the number of trailing zeros of the counter
+		// changes, so row k is updated every 2^(k+1) samples.
+		row := bits.TrailingZeros(uint(i + 1))
+		if row < pinkNoiseRows {
+			sum -= rows[row]
+			rows[row] = 2*random.Float64() - 1
+			sum += rows[row]
+		}
+
+		// A white source on top of the rows fills in the highest octave.
+		noise[i] = (sum + 2*random.Float64() - 1) / (pinkNoiseRows + 1)
+	}
+
+	return noise
+}
+
+// WriteToneFile writes a calibration file holding a sine tone of the given
+// frequency and length at -18 dBFS, the EBU R68 alignment level.  The same
+// tone is written to every channel of the description, in phase.  The file
+// is written as AIFF if the name has an AIFF extension and as WAV otherwise.
+func WriteToneFile(name string, freq, seconds float64, desc AudioDescription) error {
+	if desc.NumChannels <= 0 {
+		return errors.New("The description must have at least one channel.")
+	}
+
+	if !(freq > 0) || !(seconds > 0) {
+		return errors.New("The frequency and length of the tone must be positive.")
+	}
+
+	rate := desc.sampleRate()
+	if freq >= rate/2 {
+		return errors.New("The frequency of the tone must be below half the sample rate.")
+	}
+
+	level := DBToLinear(toneLevelDB)
+	tone := make([]float64, int(math.Round(seconds*rate)))
+	for i := range tone {
+		tone[i] = level * math.Sin(2*math.Pi*freq*float64(i)/rate)
+	}
+
+	channels := make([][]float64, desc.NumChannels)
+	for i := range channels {
+		channels[i] = tone
+	}
+
+	format := FormatWave
+	if checkExtension(name, FileExtensions(FormatAiff)...) == nil {
+		format = FormatAiff
+	}
+
+	return exportJob(ExportJob{
+		FileName:    name,
+		Format:      format,
+		Description: desc,
+		Channels:    channels,
+	})
+}
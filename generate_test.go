@@ -0,0 +1,46 @@
+package audioExport
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteToneFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "tone.wav")
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 24}
+
+	err := WriteToneFile(fileName, 1000, 0.5, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadWaveFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Channels) != 2 || len(data.Channels[0]) != 24000 {
+		t.Fatalf("got %d channels, want 2 channels of 24000 frames", len(data.Channels))
+	}
+
+	peak := 0.0
+	for _, sample := range data.Channels[0] {
+		peak = math.Max(peak, math.Abs(sample))
+	}
+	if want := DBToLinear(toneLevelDB); math.Abs(peak-want) > 1e-4 {
+		t.Errorf("the tone peaks at %v, want %v", peak, want)
+	}
+}
+
+func TestWriteToneFileRejectsNoChannels(t *testing.T) {
+	for _, channels := range []int16{0, -1} {
+		fileName := filepath.Join(t.TempDir(), "tone.wav")
+		description := AudioDescription{NumChannels: channels, SampleRate: 48000, BitsPerSample: 16}
+
+		err := WriteToneFile(fileName, 1000, 0.5, description)
+		if err == nil {
+			t.Errorf("WriteToneFile succeeded with %d channels", channels)
+		}
+	}
+}
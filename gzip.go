@@ -0,0 +1,225 @@
+package audioExport
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GzipWaveFile is used to create gzip-compressed .wav.gz files.  The sizes in
+// the WAV headers can only be written once all of the data is known, which
+// isn't possible through a stream compressor.  The WAV is therefore written
+// to a temporary file next to the destination and compressed when the file
+// is closed.  The options of the embedded WaveFile apply as usual.
+type GzipWaveFile struct {
+	WaveFile
+
+	fileName string
+}
+
+// Open creates the temporary file and writes the necessary headers.  The
+// compressed file is created with the given name, such as out.wav.gz, when
+// Close is called.
+func (g *GzipWaveFile) Open(fileName string, description AudioDescription) error {
+	return g.OpenContext(context.Background(), fileName, description)
+}
+
+// OpenWriter always returns an error.  The WAV has to be written to a
+// temporary file before it can be compressed, so it can't be written to an
+// io.Writer.
+func (g *GzipWaveFile) OpenWriter(writer io.Writer, description AudioDescription) error {
+	return errors.New("Gzip files can't be written to an io.Writer; use Open instead.")
+}
+
+// OpenAppend always returns an error.  A compressed file can't be appended
+// to in place.
+func (g *GzipWaveFile) OpenAppend(fileName string, description AudioDescription) error {
+	return errors.New("Gzip files can't be appended to.")
+}
+
+// OpenContext is like Open, but it stops waiting for the temporary file to be
+// created when the context is done, returning ctx.Err().
+func (g *GzipWaveFile) OpenContext(ctx context.Context, fileName string, description AudioDescription) error {
+	var err error
+
+	err = g.WaveFile.reset(description)
+	if err != nil {
+		return err
+	}
+
+	err = g.checkExtension(fileName)
+	if err != nil {
+		return err
+	}
+
+	return g.create(ctx, fileName)
+}
+
+// OpenWithFrameCount is like Open, but it takes the number of frames that
+// will be written, like WaveFile.OpenWithFrameCount.  The WAV is still
+// written to a temporary file and compressed when the file is closed.
+func (g *GzipWaveFile) OpenWithFrameCount(fileName string, description AudioDescription, frames uint64) error {
+	var err error
+
+	err = g.WaveFile.reset(description)
+	if err != nil {
+		return err
+	}
+
+	err = g.checkExtension(fileName)
+	if err != nil {
+		return err
+	}
+
+	g.WaveFile.sizeKnown = true
+	g.WaveFile.frameCount = frames
+	if g.WaveFile.knownDataSize() > uint64(MaxFileSize(FormatWave)) {
+		return errors.New("The frame count is too large for a .wav file.")
+	}
+
+	return g.create(context.Background(), fileName)
+}
+
+// Close completes the headers, compresses the temporary file to its
+// destination and removes it.  Close should always be called when you're done
+// writing data.
+func (g *GzipWaveFile) Close() error {
+	return g.closeWith(g.WaveFile.Close)
+}
+
+// Finalize is like Close, but it patches the sizes in the header even if
+// DeferSizes is set, like WaveFile.Finalize.
+func (g *GzipWaveFile) Finalize() error {
+	return g.closeWith(g.WaveFile.Finalize)
+}
+
+// DataWriter returns the data chunk as an io.WriteCloser, like
+// WaveFile.DataWriter.  Its Close compresses the file like Close.
+func (g *GzipWaveFile) DataWriter() io.WriteCloser {
+	return dataWriter{writeBytes: g.WriteBytes, close: g.Close}
+}
+
+// CloseInfo is like Close, but it also returns the path of the compressed
+// file and its size in bytes.
+func (g *GzipWaveFile) CloseInfo() (string, int64, error) {
+	err := g.Close()
+	if err != nil {
+		return "", 0, err
+	}
+
+	return fileInfo(g.fileName)
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// closeWith closes the temporary file with the given WaveFile method, then
+// compresses it to its destination and removes it.
+func (g *GzipWaveFile) closeWith(close func() error) error {
+	var err error
+
+	tempName := ""
+	if g.WaveFile.file != nil {
+		tempName = g.WaveFile.file.Name()
+	}
+
+	// The temporary file is removed whether or not it could be closed.
+	if tempName != "" {
+		defer os.Remove(tempName)
+	}
+
+	err = close()
+	if err != nil {
+		return err
+	}
+
+	return g.compress(tempName)
+}
+
+// checkExtension checks the extension of the destination, which is the
+// extension of a WAV followed by .gz.
+func (g *GzipWaveFile) checkExtension(fileName string) error {
+	err := g.WaveFile.checkExtension(strings.TrimSuffix(fileName, ".gz"))
+	if err != nil {
+		return err
+	}
+
+	if g.CheckExtension && !strings.HasSuffix(fileName, ".gz") {
+		return errors.New("The file extension doesn't match the format; expected .gz.")
+	}
+
+	return nil
+}
+
+// create creates the temporary file for the destination and writes the
+// headers to it.
+func (g *GzipWaveFile) create(ctx context.Context, fileName string) error {
+	var err error
+
+	g.fileName = fileName
+	g.WaveFile.name = fileName
+	g.WaveFile.file, err = createTempContext(ctx, fileName)
+	if err != nil {
+		return err
+	}
+
+	return g.WaveFile.start()
+}
+
+// compress writes the gzip-compressed contents of the temporary file to the
+// destination.  If it fails, the partial destination is removed.
+func (g *GzipWaveFile) compress(tempName string) error {
+	var err error
+
+	temp, err := os.Open(tempName)
+	if err != nil {
+		return err
+	}
+	defer temp.Close()
+
+	out, err := os.Create(g.fileName)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(out)
+	writer.Name = strings.TrimSuffix(filepath.Base(g.fileName), ".gz")
+
+	_, err = io.Copy(writer, temp)
+	if err != nil {
+		out.Close()
+		os.Remove(g.fileName)
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		out.Close()
+		os.Remove(g.fileName)
+		return err
+	}
+
+	err = out.Close()
+	if err != nil {
+		os.Remove(g.fileName)
+		return err
+	}
+
+	return nil
+}
+
+// createTempContext creates a temporary file in the directory of fileName,
+// honouring the context like createContext.
+func createTempContext(ctx context.Context, fileName string) (*os.File, error) {
+	dir := filepath.Dir(fileName)
+	pattern := filepath.Base(fileName) + ".*.tmp"
+
+	return createWithContext(ctx, func() (*os.File, error) {
+		return os.CreateTemp(dir, pattern)
+	})
+}
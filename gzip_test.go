@@ -0,0 +1,197 @@
+package audioExport
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readGzipWave decompresses a .wav.gz file and decodes the WAV inside it.
+func readGzipWave(t *testing.T, fileName string) *WaveData {
+	t.Helper()
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wavName := filepath.Join(t.TempDir(), "out.wav")
+	out, err := os.Create(wavName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = out.ReadFrom(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = out.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadWaveFile(wavName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// checkNoTempFiles fails the test if any temporary files are left in dir.
+func checkNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestGzipWaveFileOpenWithFrameCount(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "out.wav.gz")
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	var g GzipWaveFile
+	err := g.OpenWithFrameCount(fileName, description, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.WriteChannels([]float64{-1, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := readGzipWave(t, fileName)
+	if len(data.Channels) != 1 || len(data.Channels[0]) != 3 {
+		t.Fatalf("got %d channels, want 1 channel of 3 frames", len(data.Channels))
+	}
+	checkNoTempFiles(t, dir)
+}
+
+func TestGzipWaveFileDataWriter(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "out.wav.gz")
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	var g GzipWaveFile
+	err := g.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := g.DataWriter()
+	_, err = writer.Write([]byte{0x00, 0x00, 0xff, 0x7f})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := readGzipWave(t, fileName)
+	if len(data.Channels[0]) != 2 {
+		t.Fatalf("got %d frames, want 2", len(data.Channels[0]))
+	}
+	checkNoTempFiles(t, dir)
+}
+
+func TestGzipWaveFileOpenWriter(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	var g GzipWaveFile
+	err := g.OpenWriter(io.Discard, description)
+	if err == nil {
+		t.Fatal("OpenWriter succeeded, want an error")
+	}
+
+	err = g.WriteBytes([]byte{0, 0})
+	if err != ErrClosed {
+		t.Errorf("WriteBytes after OpenWriter returned %v, want ErrClosed", err)
+	}
+}
+
+func TestGzipWaveFileFinalize(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "out.wav.gz")
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	g := GzipWaveFile{WaveFile: WaveFile{DeferSizes: true}}
+	err := g.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.WriteChannels([]float64{0, 0.5, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := readGzipWave(t, fileName)
+	if len(data.Channels[0]) != 3 {
+		t.Fatalf("got %d frames, want 3", len(data.Channels[0]))
+	}
+	checkNoTempFiles(t, dir)
+}
+
+func TestGzipWaveFileOpenAppend(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+	target := writeTestWave(t, &WaveFile{}, description, []float64{0})
+
+	var g GzipWaveFile
+	err := g.OpenAppend(target, AudioDescription{})
+	if err == nil {
+		t.Fatal("OpenAppend succeeded, want an error")
+	}
+}
+
+func TestGzipWaveFileCloseErrorRemovesTempFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "out.wav.gz")
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	var g GzipWaveFile
+	err := g.OpenWithFrameCount(fileName, description, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.WriteChannels([]float64{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Close()
+	if err == nil {
+		t.Fatal("Close succeeded with fewer frames than were given to OpenWithFrameCount")
+	}
+
+	checkNoTempFiles(t, dir)
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("the destination exists after Close failed: %v", err)
+	}
+}
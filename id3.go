@@ -0,0 +1,122 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// MaxAlbumArtSize is the largest image that can be embedded as album art.  It
+// leaves the bulk of the 4 GiB size limit of WAV and AIFF files to the audio.
+const MaxAlbumArtSize = 16 << 20
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// imageMIMEType returns the MIME type of a JPEG or PNG image, or an empty
+// string for any other data.
+func imageMIMEType(image []byte) string {
+	switch {
+	case bytes.HasPrefix(image, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(image, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	default:
+		return ""
+	}
+}
+
+// validateAlbumArt checks that the image can be embedded as album art.
+func validateAlbumArt(image []byte) error {
+	if imageMIMEType(image) == "" {
+		return errors.New("The album art must be a JPEG or PNG image.")
+	}
+	if len(image) > MaxAlbumArtSize {
+		return errors.New("The album art is too large.")
+	}
+	return nil
+}
+
+// buildID3 returns the ID3v2 tag to embed in a file.  If image is set, it's
+// added to the tag as the front cover in an APIC frame; if tag is nil, a new
+// ID3v2.3 tag is created to hold it.
+func buildID3(tag, image []byte) ([]byte, error) {
+	if image == nil {
+		return tag, nil
+	}
+
+	if tag == nil {
+		tag = []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 0}
+	}
+
+	// Frames can only be appended to ID3v2.3 and ID3v2.4 tags without
+	// unsynchronisation, an extended header or a footer.
+	version := tag[3]
+	if (version != 3 && version != 4) || tag[5]&0xD0 != 0 {
+		return nil, errors.New("Album art can only be added to ID3v2.3 or ID3v2.4 tags without unsynchronisation or extended headers.")
+	}
+
+	size := int(decodeSyncsafe(tag[6:10]))
+	if 10+size > len(tag) {
+		return nil, errors.New("The ID3 tag is truncated.")
+	}
+
+	// Frames end at the padding, if there is any, or at the end of the tag.
+	frames := tag[10 : 10+size]
+	end := 0
+	for end+10 <= len(frames) && frames[end] != 0 {
+		var frameSize int
+		if version == 4 {
+			frameSize = int(decodeSyncsafe(frames[end+4 : end+8]))
+		} else {
+			frameSize = int(binary.BigEndian.Uint32(frames[end+4 : end+8]))
+		}
+		end += 10 + frameSize
+	}
+	if end > len(frames) {
+		return nil, errors.New("The ID3 tag is truncated.")
+	}
+
+	// APIC frame: text encoding, MIME type, picture type (front cover),
+	// empty description and the image itself
+	body := new(bytes.Buffer)
+	body.WriteByte(0)
+	body.WriteString(imageMIMEType(image))
+	body.WriteByte(0)
+	body.WriteByte(3)
+	body.WriteByte(0)
+	body.Write(image)
+
+	frame := make([]byte, 10, 10+body.Len())
+	copy(frame, "APIC")
+	if version == 4 {
+		encodeSyncsafe(frame[4:8], uint32(body.Len()))
+	} else {
+		binary.BigEndian.PutUint32(frame[4:8], uint32(body.Len()))
+	}
+	frame = append(frame, body.Bytes()...)
+
+	res := new(bytes.Buffer)
+	res.Write(tag[:10])
+	res.Write(frames[:end])
+	res.Write(frame)
+	res.Write(frames[end:])
+
+	out := res.Bytes()
+	encodeSyncsafe(out[6:10], uint32(len(out)-10))
+	return out, nil
+}
+
+// decodeSyncsafe decodes a 28-bit integer stored in the low 7 bits of 4 bytes.
+func decodeSyncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// encodeSyncsafe stores a 28-bit integer in the low 7 bits of 4 bytes.
+func encodeSyncsafe(b []byte, n uint32) {
+	b[0] = byte(n>>21) & 0x7F
+	b[1] = byte(n>>14) & 0x7F
+	b[2] = byte(n>>7) & 0x7F
+	b[3] = byte(n) & 0x7F
+}
@@ -0,0 +1,133 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// AiffLoopMode is the play mode of a loop of an AiffInstrument.
+type AiffLoopMode int16
+
+// The AiffLoopMode constants list the play modes of the INST chunk.
+const (
+	AiffNoLoop AiffLoopMode = iota
+	AiffForwardLoop
+	AiffForwardBackwardLoop
+)
+
+// AiffLoop is a loop of an AiffInstrument between two markers.  The markers
+// are identified by their position in the order they were added with AddCue,
+// starting from 1.
+type AiffLoop struct {
+	Mode  AiffLoopMode
+	Begin int16 // The marker at the start of the loop
+	End   int16 // The marker at the end of the loop
+}
+
+// AiffInstrument holds the fields of an AIFF INST chunk, which tells a
+// sampler how to map the file onto its keys and velocities.
+type AiffInstrument struct {
+	// BaseNote is the MIDI note at which the sample plays at its original
+	// pitch.  If it's 0, middle C (60) is written.
+	BaseNote uint8
+
+	// Detune shifts the pitch in cents, from -50 to 50.
+	Detune int8
+
+	// LowNote and HighNote give the range of MIDI notes that play the
+	// sample.  If HighNote is 0, the range extends to 127.
+	LowNote  uint8
+	HighNote uint8
+
+	// LowVelocity and HighVelocity give the range of MIDI velocities that
+	// play the sample.  A LowVelocity of 0 is written as 1, and if
+	// HighVelocity is 0, the range extends to 127.
+	LowVelocity  uint8
+	HighVelocity uint8
+
+	// Gain is the playback gain in decibels.
+	Gain int16
+
+	// SustainLoop plays while the note is held, and ReleaseLoop plays once
+	// it's released.
+	SustainLoop AiffLoop
+	ReleaseLoop AiffLoop
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// normalize returns a copy of the instrument with the defaults filled in,
+// returning an error if a field is out of range.
+func (i *AiffInstrument) normalize() (AiffInstrument, error) {
+	res := *i
+
+	if res.BaseNote == 0 {
+		res.BaseNote = 60
+	}
+	if res.HighNote == 0 {
+		res.HighNote = 127
+	}
+	if res.LowVelocity == 0 {
+		res.LowVelocity = 1
+	}
+	if res.HighVelocity == 0 {
+		res.HighVelocity = 127
+	}
+
+	if res.BaseNote > 127 || res.HighNote > 127 || res.HighVelocity > 127 {
+		return res, errors.New("MIDI notes and velocities must be at most 127.")
+	}
+
+	if res.LowNote > res.HighNote || res.LowVelocity > res.HighVelocity {
+		return res, errors.New("The low note and velocity must not exceed the high ones.")
+	}
+
+	if res.Detune < -50 || res.Detune > 50 {
+		return res, errors.New("The detune must be between -50 and 50 cents.")
+	}
+
+	for _, loop := range []AiffLoop{res.SustainLoop, res.ReleaseLoop} {
+		if loop.Mode < AiffNoLoop || loop.Mode > AiffForwardBackwardLoop {
+			return res, errors.New("Invalid loop mode.")
+		}
+
+		if loop.Mode != AiffNoLoop && (loop.Begin < 1 || loop.End < 1) {
+			return res, errors.New("A loop must begin and end at markers added with AddCue.")
+		}
+	}
+
+	return res, nil
+}
+
+// encode returns the 20-byte body of the INST chunk.  The instrument must
+// already have been normalized, and markers is the number of markers in the
+// file, which every loop must refer to.
+func (i *AiffInstrument) encode(markers int) ([]byte, error) {
+	var err error
+
+	buffer := new(bytes.Buffer)
+
+	// Base note, detune, note range, velocity range and gain
+	buffer.Write([]byte{i.BaseNote, uint8(i.Detune), i.LowNote, i.HighNote, i.LowVelocity, i.HighVelocity})
+	err = binary.Write(buffer, binary.BigEndian, i.Gain)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sustain and release loops
+	for _, loop := range []AiffLoop{i.SustainLoop, i.ReleaseLoop} {
+		if loop.Mode != AiffNoLoop && (int(loop.Begin) > markers || int(loop.End) > markers) {
+			return nil, errors.New("A loop refers to a marker that wasn't added with AddCue.")
+		}
+
+		err = binary.Write(buffer, binary.BigEndian, []int16{int16(loop.Mode), loop.Begin, loop.End})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,43 @@
+package audioExport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAiffInstrumentEncode(t *testing.T) {
+	instrument := AiffInstrument{
+		Detune:      -10,
+		Gain:        -6,
+		SustainLoop: AiffLoop{Mode: AiffForwardLoop, Begin: 1, End: 2},
+	}
+
+	normalized, err := instrument.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := normalized.encode(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0x3c, 0xf6, 0x00, 0x7f, 0x01, 0x7f, // Notes, detune and velocities
+		0xff, 0xfa, // Gain
+		0x00, 0x01, 0x00, 0x01, 0x00, 0x02, // Sustain loop
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Release loop
+	}
+	if !bytes.Equal(body, want) {
+		t.Errorf("got % x, want % x", body, want)
+	}
+}
+
+func TestAiffInstrumentEncodeMissingMarker(t *testing.T) {
+	instrument := AiffInstrument{SustainLoop: AiffLoop{Mode: AiffForwardLoop, Begin: 1, End: 3}}
+
+	_, err := instrument.encode(2)
+	if err == nil {
+		t.Error("a loop referring to a missing marker was encoded")
+	}
+}
@@ -0,0 +1,73 @@
+package audioExport
+
+// Interleave muxes the channels into a single slice of frames, where each
+// frame holds one sample from every channel in order.  The channels should
+// all be the same length; any samples beyond the end of the shortest channel
+// are ignored.
+func Interleave(channels [][]float64) []float64 {
+	if len(channels) == 0 {
+		return nil
+	}
+
+	chanLength := len(channels[0])
+	for i := range channels {
+		if len(channels[i]) < chanLength {
+			chanLength = len(channels[i])
+		}
+	}
+
+	interleaved := make([]float64, chanLength*len(channels))
+	for i := 0; i < chanLength; i++ {
+		for j := range channels {
+			interleaved[i*len(channels)+j] = channels[j][i]
+		}
+	}
+
+	return interleaved
+}
+
+// Deinterleave demuxes a slice of frames into numChannels separate channels.
+// It's the reverse of Interleave.  A partial frame at the end of the slice is
+// ignored.
+func Deinterleave(interleaved []float64, numChannels int) [][]float64 {
+	if numChannels <= 0 {
+		return nil
+	}
+
+	chanLength := len(interleaved) / numChannels
+
+	channels := make([][]float64, numChannels)
+	for j := range channels {
+		channels[j] = make([]float64, chanLength)
+	}
+
+	for i := 0; i < chanLength; i++ {
+		for j := range channels {
+			channels[j][i] = interleaved[i*numChannels+j]
+		}
+	}
+
+	return channels
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// writeComplex writes complex samples to a stereo file as I/Q data, with the
+// real part in channel 0 and the imaginary part in channel 1.
+func writeComplex(file AudioFile, samples []complex128) error {
+	numChannels := int(file.AudioDescription().NumChannels)
+	if numChannels != 2 {
+		return &ChannelCountError{Expected: numChannels, Actual: 2}
+	}
+
+	i := make([]float64, len(samples))
+	q := make([]float64, len(samples))
+	for j, sample := range samples {
+		i[j] = real(sample)
+		q[j] = imag(sample)
+	}
+
+	return file.WriteChannels(i, q)
+}
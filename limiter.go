@@ -0,0 +1,116 @@
+package audioExport
+
+import (
+	"math"
+	"time"
+)
+
+// defaultLookahead is the lookahead of a Limiter whose Lookahead is 0.
+const defaultLookahead = 5 * time.Millisecond
+
+// Limiter is a lookahead brickwall limiter, which keeps peaks at or below a
+// threshold by smoothly reducing the gain around them rather than clipping
+// individual samples.  The gain is linked across the channels, so the stereo
+// image doesn't shift.
+type Limiter struct {
+	ThresholdDB float64       // The ceiling in dBFS, such as -1
+	Release     time.Duration // How long the gain takes to recover after a peak
+	Lookahead   time.Duration // How far ahead the gain starts falling; 5ms if 0
+}
+
+// Apply limits the channels in place at the given sample rate.  Since the
+// whole signal is available, the lookahead adds no delay.  Along with the
+// channels themselves, it needs three float64 values of working memory per
+// frame.
+func (l *Limiter) Apply(channels [][]float64, sampleRate uint32) {
+	if len(channels) == 0 || len(channels[0]) == 0 {
+		return
+	}
+
+	numFrames := len(channels[0])
+	threshold := DBToLinear(l.ThresholdDB)
+
+	lookahead := l.Lookahead
+	if lookahead == 0 {
+		lookahead = defaultLookahead
+	}
+	window := int(lookahead.Seconds()*float64(sampleRate)) + 1
+
+	// The gain each frame needs on its own to stay below the threshold.
+	required := make([]float64, numFrames)
+	for i := range required {
+		peak := 0.0
+		for j := range channels {
+			peak = math.Max(peak, math.Abs(channels[j][i]))
+		}
+
+		required[i] = 1
+		if peak > threshold {
+			required[i] = threshold / peak
+		}
+	}
+
+	// The minimum over the window that follows each frame, averaged over the
+	// window that precedes it, ramps the gain down ahead of every peak.  Each
+	// average includes the peak's own requirement in every term, so the gain
+	// never exceeds it.
+	minimum := slidingMinimum(required, window)
+	gain := required
+	sum := float64(window - 1)
+	for i := 0; i < numFrames; i++ {
+		sum += minimum[i]
+		gain[i] = sum / float64(window)
+
+		// Drop the oldest frame of the window, treating the frames before
+		// the start as needing no reduction.
+		if oldest := i - window + 1; oldest >= 0 {
+			sum -= minimum[oldest]
+		} else {
+			sum--
+		}
+	}
+
+	// The gain falls immediately but recovers exponentially over the release
+	// time, which can only lower it further.
+	recovery := 1.0
+	if l.Release > 0 {
+		recovery = 1 - math.Exp(-1/(l.Release.Seconds()*float64(sampleRate)))
+	}
+	current := 1.0
+	for i := 0; i < numFrames; i++ {
+		if gain[i] < current {
+			current = gain[i]
+		} else {
+			current += (gain[i] - current) * recovery
+		}
+
+		for j := range channels {
+			channels[j][i] *= current
+		}
+	}
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// slidingMinimum returns the minimum of each window of the given length that
+// starts at each index, using a monotonic queue of indices.
+func slidingMinimum(values []float64, window int) []float64 {
+	res := make([]float64, len(values))
+	queue := make([]int, 0, window)
+
+	for i := len(values) - 1; i >= 0; i-- {
+		for len(queue) > 0 && values[queue[len(queue)-1]] >= values[i] {
+			queue = queue[:len(queue)-1]
+		}
+		queue = append(queue, i)
+
+		if queue[0] >= i+window {
+			queue = queue[1:]
+		}
+		res[i] = values[queue[0]]
+	}
+
+	return res
+}
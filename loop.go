@@ -0,0 +1,184 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// loopSearchWindow is how far WriteLoopFile looks on either side of a loop
+// point for a zero crossing.
+const loopSearchWindow = 5 * time.Millisecond
+
+// smplUnityNote is the MIDI note written as the unity note of a smpl chunk.
+const smplUnityNote = 60
+
+// SampleLoop is a loop of a smpl chunk, which samplers and game engines use
+// to repeat part of a file.
+type SampleLoop struct {
+	Start     uint32 // The first frame of the loop
+	End       uint32 // The last frame of the loop, which is played
+	PlayCount uint32 // The number of times to play the loop, or 0 forever
+}
+
+// NearestZeroCrossing returns the frame within window frames of the given one
+// at which the channels, mixed together, cross zero, i.e. the first frame
+// after a change of sign or a frame that's exactly zero.  The second result
+// is false if there's no such frame, in which case the frame is returned
+// unchanged.  The channels must all have the same length.
+func NearestZeroCrossing(channels [][]float64, frame, window int) (int, bool) {
+	return nearestCrossing(channels, frame, window, 0)
+}
+
+// WriteLoopFile writes the channels to a .wav file with a smpl chunk that
+// loops them forever between the start and end times, for seamless loops in
+// samplers and game engines.  To avoid clicks, each loop point is moved to
+// the nearest zero crossing within 5ms, and the end moves to a crossing in
+// the same direction as the start so that the wrap from the end back to the
+// start is smooth.  The returned loop holds the frames that were written.
+// aligned is false if no suitable crossing was found near one of the points,
+// which were then left where they were; the file is still written, but the
+// loop may click.
+func WriteLoopFile(name string, desc AudioDescription, start, end time.Duration, channels ...[]float64) (loop SampleLoop, aligned bool, err error) {
+	err = checkChannels(desc, channels)
+	if err != nil {
+		return loop, false, err
+	}
+
+	frames := 0
+	if len(channels) > 0 {
+		frames = len(channels[0])
+	}
+
+	startFrame := int(desc.DurationToFrame(start))
+	endFrame := int(desc.DurationToFrame(end))
+	if endFrame > frames {
+		endFrame = frames
+	}
+	if startFrame >= endFrame {
+		return loop, false, errors.New("The loop must start before it ends, within the channels.")
+	}
+
+	window := int(desc.DurationToFrame(loopSearchWindow))
+	startFrame, startAligned := nearestCrossing(channels, startFrame, window, 0)
+	direction := 0
+	if startAligned {
+		direction = crossingDirection(channels, startFrame)
+	}
+
+	// The end is the first frame after the loop, where the start plays
+	// again.
+	endFrame, endAligned := nearestCrossing(channels, endFrame, window, direction)
+	if endFrame <= startFrame {
+		return loop, false, errors.New("The loop is too short to align to zero crossings.")
+	}
+
+	loop = SampleLoop{Start: uint32(startFrame), End: uint32(endFrame - 1)}
+
+	file := new(WaveFile)
+	err = file.SetSampleLoops([]SampleLoop{loop})
+	if err != nil {
+		return loop, false, err
+	}
+
+	err = file.Open(name, desc)
+	if err != nil {
+		return loop, false, err
+	}
+
+	err = file.WriteChannels(channels...)
+	if err != nil {
+		file.Close()
+		return loop, false, err
+	}
+
+	return loop, startAligned && endAligned, file.Close()
+}
+
+/*****************************************************************************/
+/***************************** Private Functions *****************************/
+/*****************************************************************************/
+
+// nearestCrossing is like NearestZeroCrossing, but if direction isn't 0, only
+// crossings in that direction count: 1 for rising and -1 for falling.
+func nearestCrossing(channels [][]float64, frame, window, direction int) (int, bool) {
+	frames := 0
+	if len(channels) > 0 {
+		frames = len(channels[0])
+	}
+
+	for offset := 0; offset <= window; offset++ {
+		for _, candidate := range []int{frame - offset, frame + offset} {
+			if candidate < 1 || candidate >= frames {
+				continue
+			}
+
+			if !isCrossing(channels, candidate) {
+				continue
+			}
+
+			if direction == 0 || crossingDirection(channels, candidate) == direction {
+				return candidate, true
+			}
+		}
+	}
+
+	return frame, false
+}
+
+// mixedSample returns the sum of the channels at the given frame.
+func mixedSample(channels [][]float64, frame int) float64 {
+	var sum float64
+	for _, channel := range channels {
+		sum += channel[frame]
+	}
+	return sum
+}
+
+// isCrossing returns whether the mixed channels cross zero going into the
+// given frame, which must be at least 1.
+func isCrossing(channels [][]float64, frame int) bool {
+	prev, cur := mixedSample(channels, frame-1), mixedSample(channels, frame)
+	return cur == 0 || (prev != 0 && math.Signbit(prev) != math.Signbit(cur))
+}
+
+// crossingDirection returns 1 if the mixed channels rise going into the given
+// frame and -1 if they fall.
+func crossingDirection(channels [][]float64, frame int) int {
+	if mixedSample(channels, frame) >= mixedSample(channels, frame-1) {
+		return 1
+	}
+	return -1
+}
+
+// encodeSampleChunk returns the body of the smpl chunk holding the loops.
+func encodeSampleChunk(loops []SampleLoop, sampleRate float64) ([]byte, error) {
+	var err error
+
+	var period uint32
+	if sampleRate > 0 {
+		period = uint32(math.Round(1e9 / sampleRate))
+	}
+
+	buffer := new(bytes.Buffer)
+
+	// Manufacturer, product, sample period in nanoseconds, MIDI unity note,
+	// pitch fraction, SMPTE format and offset, number of loops and the size
+	// of the sampler data.
+	err = binary.Write(buffer, binary.LittleEndian, []uint32{0, 0, period, smplUnityNote, 0, 0, 0, uint32(len(loops)), 0})
+	if err != nil {
+		return nil, err
+	}
+
+	// Cue point ID, type (forward), start, end, fraction and play count
+	for i, loop := range loops {
+		err = binary.Write(buffer, binary.LittleEndian, []uint32{uint32(i), 0, loop.Start, loop.End, 0, loop.PlayCount})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package audioExport
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncodeSampleChunk(t *testing.T) {
+	loops := []SampleLoop{{Start: 10, End: 99}, {Start: 100, End: 199, PlayCount: 2}}
+
+	body, err := encodeSampleChunk(loops, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uint32{
+		0, 0, 20833, smplUnityNote, 0, 0, 0, 2, 0,
+		0, 0, 10, 99, 0, 0,
+		1, 0, 100, 199, 0, 2,
+	}
+	if len(body) != 4*len(want) {
+		t.Fatalf("got %d bytes, want %d", len(body), 4*len(want))
+	}
+	for i, field := range want {
+		if got := binary.LittleEndian.Uint32(body[4*i:]); got != field {
+			t.Errorf("field %d is %d, want %d", i, got, field)
+		}
+	}
+}
+
+func TestWaveFileSampleLoopsResampled(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	w := WaveFile{TargetSampleRate: 48000}
+	err := w.SetSampleLoops([]SampleLoop{{Start: 441, End: 4409}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := writeTestWave(t, &w, description, make([]float64, 4410))
+
+	data, err := ReadWaveFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var smpl []byte
+	for _, chunk := range data.Chunks {
+		if chunk.ID == "smpl" {
+			smpl = chunk.Body
+		}
+	}
+	if len(smpl) != 60 {
+		t.Fatalf("got a smpl chunk of %d bytes, want 60", len(smpl))
+	}
+
+	if period := binary.LittleEndian.Uint32(smpl[8:]); period != 20833 {
+		t.Errorf("the sample period is %d ns, want 20833 for 48kHz", period)
+	}
+	if start := binary.LittleEndian.Uint32(smpl[44:]); start != 480 {
+		t.Errorf("the loop starts at frame %d, want 480", start)
+	}
+	if end := binary.LittleEndian.Uint32(smpl[48:]); end != 4799 {
+		t.Errorf("the loop ends at frame %d, want 4799", end)
+	}
+}
@@ -0,0 +1,200 @@
+package audioExport
+
+import (
+	"math"
+)
+
+// The loudness constants follow ITU-R BS.1770-4.  Loudness is measured over
+// 400ms blocks that overlap by 75%, so a new block starts every 100ms.
+const (
+	loudnessSegment       = 0.1 // The time between blocks in seconds
+	loudnessSegments      = 4   // The number of segments in a block
+	loudnessOffset        = -0.691
+	loudnessAbsoluteGate  = -70.0
+	loudnessRelativeGate  = -10.0
+	surroundChannelWeight = 1.41
+)
+
+// IntegratedLoudness measures the integrated loudness of the channels in LUFS
+// following ITU-R BS.1770, with K-weighting and gating, e.g. to check that a
+// master meets a -14 LUFS target.  The channels must all have the same
+// length.  Every channel counts equally, except that six channels are taken
+// as 5.1 in WAV order, with the LFE channel ignored and the surrounds
+// weighted by 1.41.  It returns negative infinity if the channels are
+// shorter than one 400ms block or are silent.
+func IntegratedLoudness(sampleRate uint32, channels ...[]float64) float64 {
+	var m loudnessMeter
+	m.reset(int16(len(channels)), sampleRate)
+
+	for i := 0; len(channels) > 0 && i < len(channels[0]); i++ {
+		for j := range channels {
+			m.add(channels[j][i], j)
+		}
+	}
+
+	return m.integrated()
+}
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// loudnessMeter measures the integrated loudness of the samples written to a
+// file, one sample at a time.
+type loudnessMeter struct {
+	filters  [][2]*Biquad // The K-weighting filters of each channel
+	weights  []float64
+	segment  int       // The number of frames in a segment
+	frames   int       // The number of frames in the current segment
+	sum      float64   // The weighted energy of the current segment
+	segments []float64 // The weighted energy of the last few segments
+	blocks   []float64 // The mean weighted energy of each block
+}
+
+// reset clears the meter for a file with the given number of channels and
+// sample rate.  A meter without channels measures nothing.
+func (m *loudnessMeter) reset(numChannels int16, sampleRate uint32) {
+	*m = loudnessMeter{}
+	if numChannels <= 0 || sampleRate == 0 {
+		return
+	}
+
+	m.filters = make([][2]*Biquad, numChannels)
+	m.weights = make([]float64, numChannels)
+	for i := range m.filters {
+		m.filters[i] = [2]*Biquad{newKWeightingShelf(sampleRate), newKWeightingHighpass(sampleRate)}
+
+		m.weights[i] = 1
+		if numChannels == 6 && i == 3 {
+			m.weights[i] = 0
+		} else if numChannels == 6 && i >= 4 {
+			m.weights[i] = surroundChannelWeight
+		}
+	}
+
+	m.segment = int(math.Round(loudnessSegment * float64(sampleRate)))
+	if m.segment == 0 {
+		m.segment = 1
+	}
+}
+
+// add measures the next sample of the given channel.  The samples of each
+// frame must be added in channel order.
+func (m *loudnessMeter) add(data float64, channel int) {
+	if m.filters == nil {
+		return
+	}
+
+	filters := m.filters[channel]
+	y := filters[1].processSample(filters[0].processSample(data))
+	m.sum += m.weights[channel] * y * y
+
+	if channel != len(m.filters)-1 {
+		return
+	}
+
+	m.frames++
+	if m.frames < m.segment {
+		return
+	}
+
+	m.segments = append(m.segments, m.sum)
+	if len(m.segments) > loudnessSegments {
+		m.segments = m.segments[1:]
+	}
+	m.frames, m.sum = 0, 0
+
+	if len(m.segments) == loudnessSegments {
+		var energy float64
+		for _, s := range m.segments {
+			energy += s
+		}
+		m.blocks = append(m.blocks, energy/float64(loudnessSegments*m.segment))
+	}
+}
+
+// integrated returns the gated loudness of the blocks measured so far in
+// LUFS.
+func (m *loudnessMeter) integrated() float64 {
+	// The absolute gate drops the silent blocks, and the relative gate
+	// drops those well below the level of the rest.
+	mean := gatedMean(m.blocks, loudnessAbsoluteGate)
+	if mean == 0 {
+		return math.Inf(-1)
+	}
+
+	threshold := energyToLoudness(mean) + loudnessRelativeGate
+	if threshold < loudnessAbsoluteGate {
+		threshold = loudnessAbsoluteGate
+	}
+
+	mean = gatedMean(m.blocks, threshold)
+	if mean == 0 {
+		return math.Inf(-1)
+	}
+
+	return energyToLoudness(mean)
+}
+
+// gatedMean returns the mean energy of the blocks louder than the threshold
+// in LUFS, or 0 if there are none.
+func gatedMean(blocks []float64, threshold float64) float64 {
+	var sum float64
+	var count int
+
+	for _, energy := range blocks {
+		if energyToLoudness(energy) > threshold {
+			sum += energy
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// energyToLoudness converts a mean weighted energy to LUFS.
+func energyToLoudness(energy float64) float64 {
+	return loudnessOffset + 10*math.Log10(energy)
+}
+
+// newKWeightingShelf returns the first stage of the K-weighting filter, a
+// high shelf that models the acoustic effect of the head.  The coefficients
+// are derived with the bilinear transform so that they match the 48kHz
+// coefficients of BS.1770 at any sample rate.
+func newKWeightingShelf(rate uint32) *Biquad {
+	const (
+		freq   = 1681.974450955533
+		gainDB = 3.999843853973347
+		q      = 0.7071752369554196
+	)
+
+	k := math.Tan(math.Pi * freq / float64(rate))
+	vh := math.Pow(10, gainDB/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+
+	return newBiquad(
+		vh+vb*k/q+k*k, 2*(k*k-vh), vh-vb*k/q+k*k,
+		1+k/q+k*k, 2*(k*k-1), 1-k/q+k*k,
+	)
+}
+
+// newKWeightingHighpass returns the second stage of the K-weighting filter,
+// the revised low-frequency B-curve high-pass filter.
+func newKWeightingHighpass(rate uint32) *Biquad {
+	const (
+		freq = 38.13547087602444
+		q    = 0.5003270373238773
+	)
+
+	k := math.Tan(math.Pi * freq / float64(rate))
+	a0 := 1 + k/q + k*k
+
+	// The numerator is left unnormalized, as in BS.1770.
+	return newBiquad(
+		a0, -2*a0, a0,
+		a0, 2*(k*k-1), 1-k/q+k*k,
+	)
+}
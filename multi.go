@@ -0,0 +1,131 @@
+package audioExport
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MultiAudioFile writes the same audio to several files at once, e.g. a WAV
+// and an AIFF of the same render.  The files can be opened individually
+// before they're added, in which case they should all have been opened with
+// the same number of channels, or together with Open.
+type MultiAudioFile struct {
+	Files []AudioFile
+}
+
+var _ AudioFile = (*MultiAudioFile)(nil)
+
+// Open opens each of the files with the description.  Every file is named
+// after fileName with the extension of its format, e.g. mix.wav and mix.aiff
+// for Open("mix.wav", ...), so only WaveFiles and AiffFiles can be opened
+// this way.  Later files of the same format get a sequence number before the
+// extension, e.g. mix.2.wav, so that no file overwrites another.  If any file
+// can't be opened, the others are closed and all of the errors are returned
+// together.
+func (m *MultiAudioFile) Open(fileName string, description AudioDescription) error {
+	var errs []error
+
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	opened := make([]AudioFile, 0, len(m.Files))
+	counts := make(map[FileFormat]int)
+
+	for _, file := range m.Files {
+		var format FileFormat
+		switch file.(type) {
+		case *WaveFile:
+			format = FormatWave
+		case *AiffFile:
+			format = FormatAiff
+		default:
+			errs = append(errs, errors.New("Only WaveFiles and AiffFiles can be opened by a MultiAudioFile."))
+			continue
+		}
+
+		name := base
+		counts[format]++
+		if counts[format] > 1 {
+			name += fmt.Sprintf(".%d", counts[format])
+		}
+
+		err := file.Open(name+FileExtensions(format)[0], description)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		opened = append(opened, file)
+	}
+
+	if len(errs) != 0 {
+		for _, file := range opened {
+			file.Close()
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// WriteChannels writes the channels to each of the files.  A failure in one
+// file doesn't prevent the others from being written; all of the errors are
+// returned together.
+func (m *MultiAudioFile) WriteChannels(channels ...[]float64) error {
+	var errs []error
+
+	for _, file := range m.Files {
+		err := file.WriteChannels(channels...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// WriteBytes writes the binary waveform to each of the files.  The same bytes
+// are given to every file, so WriteBytes only makes sense when all of the
+// files share the same sample format and byte order.  WAV and AIFF files
+// don't, which is why WriteChannels is usually more suitable.
+func (m *MultiAudioFile) WriteBytes(bytes []byte) error {
+	var errs []error
+
+	for _, file := range m.Files {
+		writer, ok := file.(interface {
+			WriteBytes(bytes []byte) error
+		})
+		if !ok {
+			errs = append(errs, errors.New("The file doesn't support writing bytes."))
+			continue
+		}
+
+		err := writer.WriteBytes(bytes)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes each of the files.  Every file is closed even if closing an
+// earlier one fails; all of the errors are returned together.
+func (m *MultiAudioFile) Close() error {
+	var errs []error
+
+	for _, file := range m.Files {
+		err := file.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// AudioDescription returns the description of the first file.
+func (m *MultiAudioFile) AudioDescription() AudioDescription {
+	if len(m.Files) == 0 {
+		return AudioDescription{}
+	}
+	return m.Files[0].AudioDescription()
+}
@@ -0,0 +1,96 @@
+package audioExport
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMultiAudioFile(t *testing.T) {
+	dir := t.TempDir()
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	var file AudioFile = &MultiAudioFile{Files: []AudioFile{new(WaveFile), new(AiffFile)}}
+	err := file.Open(filepath.Join(dir, "mix.wav"), description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.AudioDescription() != description {
+		t.Errorf("got description %+v, want %+v", file.AudioDescription(), description)
+	}
+
+	err = file.WriteChannels([]float64{-1, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wave, err := ReadWaveFile(filepath.Join(dir, "mix.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aiff, err := ReadAiffFile(filepath.Join(dir, "mix.aiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range wave.Channels[0] {
+		if wave.Channels[0][i] != aiff.Channels[0][i] {
+			t.Errorf("frame %d is %v in the WAV and %v in the AIFF", i, wave.Channels[0][i], aiff.Channels[0][i])
+		}
+	}
+}
+
+func TestMultiAudioFileOpenClosesOnError(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+	wave := new(WaveFile)
+
+	m := MultiAudioFile{Files: []AudioFile{wave, new(NullFile)}}
+	err := m.Open(filepath.Join(t.TempDir(), "mix.wav"), description)
+	if err == nil {
+		t.Fatal("Open succeeded with a file that can't be named")
+	}
+
+	err = wave.WriteBytes([]byte{0, 0})
+	if err != ErrClosed {
+		t.Errorf("the WAV is still open after Open failed: %v", err)
+	}
+}
+
+func TestMultiAudioFileOpenSameFormat(t *testing.T) {
+	dir := t.TempDir()
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	first := new(WaveFile)
+	second := &WaveFile{ExtendedFmt: true}
+	m := MultiAudioFile{Files: []AudioFile{first, second}}
+
+	err := m.Open(filepath.Join(dir, "mix.wav"), description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.WriteChannels([]float64{-1, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"mix.wav", "mix.2.wav"} {
+		data, err := ReadWaveFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(data.Channels[0]) != 3 {
+			t.Errorf("%s: got %d frames, want 3", name, len(data.Channels[0]))
+		}
+	}
+}
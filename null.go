@@ -0,0 +1,85 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// NullFile performs all of the work of writing a .wav file but discards the
+// bytes instead of writing them to disk.  It's useful for benchmarking the
+// generation of audio separately from the cost of I/O.
+type NullFile struct {
+	wave         WaveFile
+	bytesWritten uint64
+	closed       bool
+}
+
+// Open checks the description as WaveFile.Open would, then builds and
+// discards the headers.  The file name is ignored.
+func (n *NullFile) Open(fileName string, description AudioDescription) error {
+	err := n.wave.reset(description)
+	if err != nil {
+		return err
+	}
+
+	n.bytesWritten = 0
+	n.closed = false
+
+	return n.wave.writeHeader(new(bytes.Buffer))
+}
+
+// WriteBytes discards the bytes, adding their length to the number of bytes
+// written.
+func (n *NullFile) WriteBytes(bytes []byte) error {
+	if n.closed {
+		return ErrClosed
+	}
+
+	n.bytesWritten += uint64(len(bytes))
+	return nil
+}
+
+// WriteChannels muxes and encodes the channels exactly as a WaveFile would,
+// then discards the result.
+func (n *NullFile) WriteChannels(channels ...[]float64) error {
+	var err error
+
+	err = checkChannels(n.wave.description, channels)
+	if err != nil {
+		return err
+	}
+
+	if isStereo16(n.wave.description) {
+		return n.WriteBytes(encodeStereo16(channels[0], channels[1], binary.LittleEndian))
+	}
+
+	data, err := encodeChannels(channels, func(data float64, channel, frame int, buffer *bytes.Buffer) error {
+		return n.wave.writeFloatToBuffer(data, buffer)
+	})
+	if err != nil {
+		return err
+	}
+
+	return n.WriteBytes(data)
+}
+
+// Close marks the file as closed.
+func (n *NullFile) Close() error {
+	if n.closed {
+		return ErrClosed
+	}
+
+	n.closed = true
+	return nil
+}
+
+// AudioDescription acts as a getter for the AudioDescription provided to the
+// Open method.
+func (n *NullFile) AudioDescription() AudioDescription {
+	return n.wave.description
+}
+
+// BytesWritten returns the number of data bytes that would have been written.
+func (n *NullFile) BytesWritten() uint64 {
+	return n.bytesWritten
+}
@@ -0,0 +1,52 @@
+package audioExport
+
+import (
+	"testing"
+)
+
+func TestNullFileWriteChannels(t *testing.T) {
+	tests := []struct {
+		description AudioDescription
+		want        uint64
+	}{
+		{AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16}, 12},
+		{AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 24}, 18},
+		{AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}, 6},
+	}
+
+	for _, test := range tests {
+		var n NullFile
+		err := n.Open("", test.description)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		channels := make([][]float64, test.description.NumChannels)
+		for i := range channels {
+			channels[i] = []float64{-1, 0, 1}
+		}
+
+		err = n.WriteChannels(channels...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n.BytesWritten() != test.want {
+			t.Errorf("%+v: wrote %d bytes, want %d", test.description, n.BytesWritten(), test.want)
+		}
+	}
+}
+
+func TestNullFileOpenChecksDescription(t *testing.T) {
+	tests := []AudioDescription{
+		{NumChannels: 0, SampleRate: 44100, BitsPerSample: 16},
+		{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16, Format: FormatIEEEFloat},
+	}
+
+	for _, description := range tests {
+		var n NullFile
+		if n.Open("", description) == nil {
+			t.Errorf("%+v: Open succeeded, want an error", description)
+		}
+	}
+}
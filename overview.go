@@ -0,0 +1,86 @@
+package audioExport
+
+// MinMax is the range of the samples of one channel in a bin of a waveform
+// overview.
+type MinMax struct {
+	Min float64
+	Max float64
+}
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// overview accumulates the range of each channel over bins of binSize frames.
+type overview struct {
+	binSize int
+	bins    [][]MinMax
+	frames  []int // The number of samples added to each channel
+}
+
+// reset clears the overview for a file with the given number of channels.  A
+// binSize of 0 disables it.
+func (o *overview) reset(numChannels int16, binSize int) {
+	o.binSize = binSize
+	o.bins = nil
+	o.frames = nil
+
+	if binSize > 0 && numChannels > 0 {
+		o.bins = make([][]MinMax, numChannels)
+		o.frames = make([]int, numChannels)
+	}
+}
+
+// add records the next sample of the given channel.
+func (o *overview) add(data float64, channel int) {
+	if o.frames == nil {
+		return
+	}
+
+	if o.frames[channel]%o.binSize == 0 {
+		o.bins[channel] = append(o.bins[channel], MinMax{Min: data, Max: data})
+	} else {
+		bin := &o.bins[channel][len(o.bins[channel])-1]
+		if data < bin.Min {
+			bin.Min = data
+		}
+		if data > bin.Max {
+			bin.Max = data
+		}
+	}
+
+	o.frames[channel]++
+}
+
+// merge returns the overview in bins of binSize frames, which must be a
+// multiple of the size it was recorded at.  It returns nil otherwise.
+func (o *overview) merge(binSize int) [][]MinMax {
+	if o.frames == nil || binSize <= 0 || binSize%o.binSize != 0 {
+		return nil
+	}
+
+	factor := binSize / o.binSize
+	res := make([][]MinMax, len(o.bins))
+	for i, bins := range o.bins {
+		res[i] = make([]MinMax, 0, (len(bins)+factor-1)/factor)
+		for start := 0; start < len(bins); start += factor {
+			end := start + factor
+			if end > len(bins) {
+				end = len(bins)
+			}
+
+			merged := bins[start]
+			for _, bin := range bins[start+1 : end] {
+				if bin.Min < merged.Min {
+					merged.Min = bin.Min
+				}
+				if bin.Max > merged.Max {
+					merged.Max = bin.Max
+				}
+			}
+			res[i] = append(res[i], merged)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,128 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// RawFile is used to create headerless files of raw PCM samples, such as .pcm
+// or .raw files.  Since there's no header, the consumer must be told the
+// format separately.
+type RawFile struct {
+	// ByteOrder is the byte order of the samples, such as binary.BigEndian
+	// for a device that expects big-endian PCM.  Little-endian is used if
+	// it's nil.
+	ByteOrder binary.ByteOrder
+
+	// Signed8Bit writes 8-bit samples as signed integers.  By default they're
+	// unsigned, as in WAV files.
+	Signed8Bit bool
+
+	file        *os.File
+	description AudioDescription
+	closed      bool
+}
+
+// Open creates the file.  The corresponding Close method should always be
+// called when you're done writing data.
+func (r *RawFile) Open(fileName string, description AudioDescription) error {
+	var err error
+
+	if description.NumChannels <= 0 {
+		return errors.New("The description must have at least one channel.")
+	}
+
+	if description.isFloat() && description.containerBits() != BPS32 && description.containerBits() != BPS64 {
+		return errors.New("Floating-point samples must be 32 or 64 bits.")
+	}
+
+	if !description.isFloat() {
+		switch description.containerBits() {
+		case BPS8, BPS16, BPS24, BPS32:
+		default:
+			return errors.New("Invalid bit depth.")
+		}
+	}
+
+	r.description = description
+	r.closed = false
+	r.file, err = os.Create(fileName)
+	return err
+}
+
+// WriteBytes writes the binary waveform to the file.  It expects muxed data
+// in the format specified by the audio description and the byte order.  It
+// returns ErrClosed if the file isn't open and a *ShortWriteError if the data
+// couldn't be written in full.
+func (r *RawFile) WriteBytes(bytes []byte) error {
+	if r.closed || r.file == nil {
+		return ErrClosed
+	}
+
+	n, err := r.file.Write(bytes)
+	return shortWrite(n, len(bytes), err)
+}
+
+// WriteChannels muxes and writes the channels to the file.  Each channel
+// should be a float64 slice where each item in the array ranges from -1 to 1.
+// Any values beyond these bounds will be automatically clipped.
+func (r *RawFile) WriteChannels(channels ...[]float64) error {
+	var err error
+
+	err = checkChannels(r.description, channels)
+	if err != nil {
+		return err
+	}
+
+	if isStereo16(r.description) {
+		return r.WriteBytes(encodeStereo16(channels[0], channels[1], r.byteOrder()))
+	}
+
+	data, err := encodeChannels(channels, func(data float64, channel, frame int, buffer *bytes.Buffer) error {
+		return encodeSample(data, r.description, r.byteOrder(), r.Signed8Bit, buffer)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.WriteBytes(data)
+}
+
+// WriteComplex writes complex samples, such as the I/Q data of a software
+// defined radio, to a stereo file.  The real part (I) of each sample is
+// written to channel 0 and the imaginary part (Q) to channel 1.  The file
+// must have been opened with 2 channels.
+func (r *RawFile) WriteComplex(samples []complex128) error {
+	return writeComplex(r, samples)
+}
+
+// Close closes the file.  There are no headers to complete, but Close should
+// always be called when you're done writing data.
+func (r *RawFile) Close() error {
+	if r.closed || r.file == nil {
+		return ErrClosed
+	}
+
+	r.closed = true
+	return r.file.Close()
+}
+
+// AudioDescription acts as a getter for the AudioDescription provided to the
+// Open method.
+func (r *RawFile) AudioDescription() AudioDescription {
+	return r.description
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// byteOrder returns the byte order of the samples.
+func (r *RawFile) byteOrder() binary.ByteOrder {
+	if r.ByteOrder == nil {
+		return binary.LittleEndian
+	}
+	return r.ByteOrder
+}
@@ -0,0 +1,26 @@
+package audioExport
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRawFileOpenChecksDescription(t *testing.T) {
+	tests := []struct {
+		description AudioDescription
+		want        string
+	}{
+		{AudioDescription{NumChannels: 0, SampleRate: 44100, BitsPerSample: 16}, "The description must have at least one channel."},
+		{AudioDescription{NumChannels: -1, SampleRate: 44100, BitsPerSample: 16}, "The description must have at least one channel."},
+		{AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 12}, "Invalid bit depth."},
+		{AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 64}, "Invalid bit depth."},
+	}
+
+	for _, test := range tests {
+		var r RawFile
+		err := r.Open(filepath.Join(t.TempDir(), "out.raw"), test.description)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%+v: Open returned %v, want %q", test.description, err, test.want)
+		}
+	}
+}
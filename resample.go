@@ -0,0 +1,109 @@
+package audioExport
+
+import (
+	"math"
+)
+
+// resampleZeroCrossings is the number of zero crossings of the sinc kernel on
+// each side of a resampled point.
+const resampleZeroCrossings = 16
+
+// Resample converts the channel from one sample rate to another using a
+// Blackman-windowed sinc interpolator.  When downsampling, the kernel is
+// widened so that frequencies above the new Nyquist rate are filtered out
+// instead of aliasing.
+func Resample(channel []float64, fromRate, toRate uint32) []float64 {
+	if fromRate == toRate || fromRate == 0 || toRate == 0 {
+		return append([]float64(nil), channel...)
+	}
+
+	ratio := float64(toRate) / float64(fromRate)
+	cutoff := math.Min(1, ratio)
+	halfWidth := resampleZeroCrossings / cutoff
+
+	res := make([]float64, int(math.Round(float64(len(channel))*ratio)))
+	for i := range res {
+		pos := float64(i) / ratio
+
+		start := int(math.Ceil(pos - halfWidth))
+		if start < 0 {
+			start = 0
+		}
+		end := int(math.Floor(pos + halfWidth))
+		if end > len(channel)-1 {
+			end = len(channel) - 1
+		}
+
+		var sum float64
+		for j := start; j <= end; j++ {
+			x := float64(j) - pos
+			sum += channel[j] * cutoff * sinc(cutoff*x) * blackman(x/halfWidth)
+		}
+		res[i] = sum
+	}
+
+	return res
+}
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// sinc returns the normalized sinc function of x.
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman returns the Blackman window at t, which ranges from -1 to 1.
+func blackman(t float64) float64 {
+	if t <= -1 || t >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*t) + 0.08*math.Cos(2*math.Pi*t)
+}
+
+// resampleBuffer holds the channels written to a file that resamples its data
+// when it's closed.
+type resampleBuffer struct {
+	channels [][]float64
+}
+
+// reset empties the buffer and prepares it for the given number of channels.
+func (b *resampleBuffer) reset(numChannels int16) {
+	b.channels = make([][]float64, numChannels)
+}
+
+// append adds the channels to the end of the buffer.
+func (b *resampleBuffer) append(channels [][]float64) {
+	for i := range channels {
+		b.channels[i] = append(b.channels[i], channels[i]...)
+	}
+}
+
+// appendFrame adds a single frame to the end of the buffer.
+func (b *resampleBuffer) appendFrame(sample []float64) {
+	for i := range sample {
+		b.channels[i] = append(b.channels[i], sample[i])
+	}
+}
+
+// take returns the buffered channels and empties the buffer.
+func (b *resampleBuffer) take() [][]float64 {
+	res := b.channels
+	b.channels = make([][]float64, len(res))
+	return res
+}
+
+// resample returns the buffered channels converted to the new sample rate
+// and empties the buffer.
+func (b *resampleBuffer) resample(fromRate, toRate uint32) [][]float64 {
+	res := make([][]float64, len(b.channels))
+	for i := range b.channels {
+		res[i] = Resample(b.channels[i], fromRate, toRate)
+		b.channels[i] = nil
+	}
+	return res
+}
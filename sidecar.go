@@ -0,0 +1,74 @@
+package audioExport
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+)
+
+// SidecarInfo is the content of the JSON sidecar written next to a file when
+// WriteSidecar is set.
+type SidecarInfo struct {
+	Description AudioDescription `json:"description"`
+	Frames      uint64           `json:"frames"`
+	Duration    float64          `json:"durationSeconds"`
+	Peak        float64          `json:"peak"`
+	RMS         float64          `json:"rms"`
+	Clips       uint64           `json:"clips"`
+}
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// levelMeter measures the levels of the samples written to a file.
+type levelMeter struct {
+	peak       float64
+	sumSquares float64
+	samples    uint64
+	clips      uint64
+}
+
+// add measures a sample before it's quantized.  Samples beyond full scale are
+// counted as clips.
+func (m *levelMeter) add(data float64) {
+	abs := math.Abs(data)
+	if abs > m.peak {
+		m.peak = abs
+	}
+	if abs > 1 {
+		m.clips++
+	}
+
+	m.sumSquares += data * data
+	m.samples++
+}
+
+// rms returns the root mean square level of the samples measured so far.
+func (m *levelMeter) rms() float64 {
+	if m.samples == 0 {
+		return 0
+	}
+	return math.Sqrt(m.sumSquares / float64(m.samples))
+}
+
+// writeSidecar writes the JSON sidecar of the named file to fileName.json.
+func writeSidecar(fileName string, desc AudioDescription, frames uint64, levels *levelMeter) error {
+	info := SidecarInfo{
+		Description: desc,
+		Frames:      frames,
+		Peak:        levels.peak,
+		RMS:         levels.rms(),
+		Clips:       levels.clips,
+	}
+	if desc.sampleRate() > 0 {
+		info.Duration = float64(frames) / desc.sampleRate()
+	}
+
+	body, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName+".json", append(body, '\n'), 0666)
+}
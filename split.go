@@ -0,0 +1,176 @@
+package audioExport
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSplitSize is the number of data bytes written to each file by a
+// SplitWriter whose MaxBytes is 0.  It keeps every part well within the limits
+// of both WAV and AIFF as well as the 4GB file size limit of FAT32.
+const DefaultSplitSize int64 = math.MaxInt32 - 1<<16
+
+// SplitWriter spreads a long export across several files of a limited size.
+// The parts are named after the file name given to Open with a 4-digit
+// sequence number before the extension, e.g. name.0001.wav, name.0002.wav.
+// Each part is an independently valid file with its own headers.
+type SplitWriter struct {
+	// NewFile returns the AudioFile used for each part, such as a new
+	// WaveFile.
+	NewFile func() AudioFile
+
+	// MaxBytes is the maximum number of data bytes written to each part.  If
+	// MaxBytes is 0, DefaultSplitSize is used.
+	MaxBytes int64
+
+	fileName     string
+	description  AudioDescription
+	current      AudioFile
+	parts        int
+	bytesWritten int64
+}
+
+// Open stores the description and opens the first part.  The corresponding
+// Close method should always be called when you're done writing data.
+func (s *SplitWriter) Open(fileName string, description AudioDescription) error {
+	if s.NewFile == nil {
+		return errors.New("The SplitWriter has no NewFile function.")
+	}
+
+	s.fileName = fileName
+	s.description = description
+	s.parts = 0
+
+	return s.nextPart()
+}
+
+// WriteChannels muxes and writes the channels, starting a new part whenever
+// the current one is full.  Parts are always split on frame boundaries.
+func (s *SplitWriter) WriteChannels(channels ...[]float64) error {
+	var err error
+
+	if s.current == nil {
+		return ErrClosed
+	}
+
+	frameSize := s.frameSize()
+	if frameSize <= 0 {
+		return errors.New("Invalid audio description.")
+	}
+
+	maxBytes := s.maxBytes()
+	if maxBytes < frameSize {
+		return errors.New("MaxBytes is smaller than a single frame.")
+	}
+
+	err = checkChannels(s.description, channels)
+	if err != nil {
+		return err
+	}
+	chanLength := len(channels[0])
+
+	for start := 0; start < chanLength; {
+		if s.bytesWritten+frameSize > maxBytes {
+			err = s.nextPart()
+			if err != nil {
+				return err
+			}
+		}
+
+		// Write as many frames as will fit in the current part.
+		end := start + int((maxBytes-s.bytesWritten)/frameSize)
+		if end > chanLength {
+			end = chanLength
+		}
+
+		part := make([][]float64, len(channels))
+		for i := range channels {
+			part[i] = channels[i][start:end]
+		}
+
+		err = s.current.WriteChannels(part...)
+		if err != nil {
+			return err
+		}
+
+		s.bytesWritten += int64(end-start) * frameSize
+		start = end
+	}
+
+	return nil
+}
+
+// Close closes the current part.  Close should always be called when you're
+// done writing data.
+func (s *SplitWriter) Close() error {
+	if s.current == nil {
+		return ErrClosed
+	}
+
+	err := s.current.Close()
+	s.current = nil
+	return err
+}
+
+// AudioDescription acts as a getter for the AudioDescription provided to the
+// Open method.
+func (s *SplitWriter) AudioDescription() AudioDescription {
+	return s.description
+}
+
+// Parts returns the number of files that have been opened so far.
+func (s *SplitWriter) Parts() int {
+	return s.parts
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// nextPart closes the current part, if any, and opens the next one.
+func (s *SplitWriter) nextPart() error {
+	var err error
+
+	if s.current != nil {
+		err = s.current.Close()
+		s.current = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	s.parts++
+	s.bytesWritten = 0
+
+	file := s.NewFile()
+	err = file.Open(s.partName(s.parts), s.description)
+	if err != nil {
+		return err
+	}
+
+	s.current = file
+	return nil
+}
+
+// partName returns the file name of the given part.
+func (s *SplitWriter) partName(part int) string {
+	ext := filepath.Ext(s.fileName)
+	base := strings.TrimSuffix(s.fileName, ext)
+	return fmt.Sprintf("%s.%04d%s", base, part, ext)
+}
+
+// frameSize returns the number of bytes in a single muxed frame.
+func (s *SplitWriter) frameSize() int64 {
+	return int64(s.description.NumChannels) * int64(s.description.containerBits()) / 8
+}
+
+// maxBytes returns the maximum number of data bytes for each part.
+func (s *SplitWriter) maxBytes() int64 {
+	if s.MaxBytes == 0 {
+		return DefaultSplitSize
+	}
+	return s.MaxBytes
+}
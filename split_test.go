@@ -0,0 +1,28 @@
+package audioExport
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitWriterChecksChannels(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 16}
+	s := SplitWriter{NewFile: func() AudioFile { return new(WaveFile) }}
+
+	err := s.Open(filepath.Join(t.TempDir(), "out.wav"), description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.WriteChannels([]float64{0})
+	if !errors.Is(err, ErrChannelCountMismatch) {
+		t.Errorf("one channel returned %v, want ErrChannelCountMismatch", err)
+	}
+
+	err = s.WriteChannels([]float64{0, 0}, []float64{0})
+	if err == nil {
+		t.Error("channels of different lengths were accepted")
+	}
+}
@@ -0,0 +1,164 @@
+package audioExport
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// DepthOutput is one of the files written by ExportDepths.
+type DepthOutput struct {
+	FileName      string
+	BitsPerSample int16
+	Dither        bool // Whether TPDF dither is added before quantizing
+}
+
+// WriteSplitStereo writes the left and right channels to two mono files named
+// baseName.L.wav and baseName.R.wav.  The description's NumChannels is
+// ignored; each file is written with a single channel.
+func WriteSplitStereo(baseName string, desc AudioDescription, left, right []float64) error {
+	var err error
+
+	desc.NumChannels = 1
+
+	err = writeWaveFile(baseName+".L.wav", desc, left)
+	if err != nil {
+		return err
+	}
+
+	return writeWaveFile(baseName+".R.wav", desc, right)
+}
+
+// WriteStereoPairs writes the channels to stereo files of adjacent pairs,
+// named baseName.1-2.wav, baseName.3-4.wav and so on, as some consoles ingest
+// surround mixes.  If the number of channels is odd, the last one is written
+// to a mono file such as baseName.5.wav.  The description's NumChannels is
+// ignored.
+func WriteStereoPairs(baseName string, desc AudioDescription, channels [][]float64) error {
+	var err error
+
+	desc.NumChannels = int16(len(channels))
+	err = checkChannels(desc, channels)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(channels); i += 2 {
+		if i+1 == len(channels) {
+			desc.NumChannels = 1
+			return writeWaveFile(fmt.Sprintf("%s.%d.wav", baseName, i+1), desc, channels[i])
+		}
+
+		desc.NumChannels = 2
+		err = writeWaveFile(fmt.Sprintf("%s.%d-%d.wav", baseName, i+1, i+2), desc, channels[i], channels[i+1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeWaveFile writes the channels to a complete .wav file.
+func writeWaveFile(fileName string, desc AudioDescription, channels ...[]float64) error {
+	var err error
+
+	file := new(WaveFile)
+	err = file.Open(fileName, desc)
+	if err != nil {
+		return err
+	}
+
+	err = file.WriteChannels(channels...)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// ExportDepths writes the same render to a .wav file for each output, such as
+// a 24-bit master and a dithered 16-bit copy.  The description gives the
+// number of channels and the sample rate, and each output's BitsPerSample
+// replaces its bit depth.  The peak level of the channels is measured once
+// for every output and returned, and each output is encoded in a single pass
+// over the samples.  Dither isn't added to floating-point outputs.
+func ExportDepths(desc AudioDescription, outputs []DepthOutput, channels ...[]float64) (float64, error) {
+	var err error
+
+	err = checkChannels(desc, channels)
+	if err != nil {
+		return 0, err
+	}
+
+	var peak float64
+	for _, channel := range channels {
+		for _, sample := range channel {
+			peak = math.Max(peak, math.Abs(sample))
+		}
+	}
+
+	for _, output := range outputs {
+		outputDesc := desc
+		outputDesc.BitsPerSample = output.BitsPerSample
+		outputDesc.ContainerBits = 0
+
+		err = writeDepth(output, outputDesc, channels)
+		if err != nil {
+			return peak, err
+		}
+	}
+
+	return peak, nil
+}
+
+// writeDepth writes one of the outputs of ExportDepths, encoding the channels
+// in blocks so that the encoded file doesn't need to fit in memory.
+func writeDepth(output DepthOutput, desc AudioDescription, channels [][]float64) error {
+	var err error
+
+	file := new(WaveFile)
+	err = file.Open(output.FileName, desc)
+	if err != nil {
+		return err
+	}
+
+	var dither *ditherer
+	if output.Dither && !desc.isFloat() {
+		dither = newDitherer(desc.validBits())
+	}
+
+	encode := func(data float64, channel, frame int, buffer *bytes.Buffer) error {
+		if dither != nil {
+			data = dither.apply(data)
+		}
+		return file.writeFloatToBuffer(data, buffer)
+	}
+
+	block := make([][]float64, len(channels))
+	for start := 0; len(channels) > 0 && start < len(channels[0]); start += silenceBlockSize {
+		end := start + silenceBlockSize
+		if end > len(channels[0]) {
+			end = len(channels[0])
+		}
+
+		for j := range channels {
+			block[j] = channels[j][start:end]
+		}
+
+		data, err := encodeChannels(block, encode)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		err = file.WriteBytes(data)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	return file.Close()
+}
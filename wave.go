@@ -2,16 +2,192 @@ package audioExport
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
 	"os"
+	"time"
 )
 
+// subFormatPCM is the GUID identifying PCM data in an extensible fmt chunk.
+var subFormatPCM = []byte{
+	0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00,
+	0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71,
+}
+
+// subFormatIEEEFloat is the GUID identifying IEEE floating-point data in an
+// extensible fmt chunk.
+var subFormatIEEEFloat = []byte{
+	0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00,
+	0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71,
+}
+
+// subFormatAmbisonic is the GUID identifying ambisonic B-format PCM data in an
+// extensible fmt chunk, as used by .amb files.  The IEEE float variant differs
+// only in its first byte.
+var subFormatAmbisonic = []byte{
+	0x01, 0x00, 0x00, 0x00, 0x21, 0x07, 0xD3, 0x11,
+	0x86, 0x44, 0xC8, 0xC1, 0xCA, 0x00, 0x00, 0x00,
+}
+
+// ds64Size is the size of the body of an RF64 ds64 chunk without a table: the
+// 64-bit RIFF size, data size and sample count followed by the table length.
+const ds64Size = 28
+
 // WaveFile is used to create uncompressed .wav files.
 type WaveFile struct {
+	// ExtendedFmt writes the 18-byte form of the fmt chunk, which ends with a
+	// cbSize of 0.  Some decoders require it, but the default 16-byte form is
+	// the most compatible.  It has no effect when the 40-byte extensible form
+	// is needed, such as for 20-bit audio in 24-bit containers.
+	ExtendedFmt bool
+
+	// PadToBlock makes Close pad the data chunk with silence up to the next
+	// multiple of PadToBlock bytes.  It must be a multiple of the frame size.
+	// If PadToBlock is 0, no padding is written.
+	PadToBlock uint32
+
+	// Checksum, if set, is fed every byte written to the data chunk, such as
+	// crc32.NewIEEE() or sha256.New().  The result is returned by
+	// DataChecksum.
+	Checksum hash.Hash
+
+	// Streaming writes the RIFF and data chunk sizes as 0xFFFFFFFF, which
+	// many players treat as unknown, and never patches them.  This makes the
+	// file playable while it's still being written, e.g. over a socket.
+	Streaming bool
+
+	// TargetSampleRate, if set, is the sample rate written to the file.  The
+	// channels are buffered and resampled when the file is closed.  See Writer
+	// options in the package documentation.
+	TargetSampleRate uint32
+
+	// Limiter, if set, is applied to the buffered channels when the file is
+	// closed.  See Writer options in the package documentation.
+	Limiter *Limiter
+
+	// Ambisonic tags the file as ambisonic B-format (the .amb format) using
+	// the extensible fmt chunk, so that compatible players decode it
+	// spatially instead of as discrete speakers.  The channels must be given
+	// in Furse-Malham order, i.e. W, X, Y and Z for first order, and there
+	// must be between 3 and 16 of them.
+	Ambisonic bool
+
+	// UpdateInterval, if set, makes the RIFF and data chunk sizes be patched
+	// after every UpdateInterval bytes of data, rather than only at Close.  A
+	// recording cut short by a crash then remains playable up to the last
+	// update.  It has no effect when Streaming is set.
+	UpdateInterval uint32
+
+	// WriteSidecar makes Close write a JSON description of the file next to
+	// it, named after the file with .json appended.  See Writer options in the
+	// package documentation.  The levels don't include the
+	// silence added by PadToBlock.
+	WriteSidecar bool
+
+	// ReferenceScale, if set, is the fraction of full scale that a sample of
+	// 1.0 is written at.  See Writer options in the package documentation.
+	ReferenceScale float64
+
+	// StrictClip makes writing fail with a *ClipError on the first sample
+	// outside the range -1.0 to 1.0.  See Writer options in the package
+	// documentation.
+	StrictClip bool
+
+	// OverviewBinSize, if set, is the number of frames in each bin of the
+	// waveform overview.  See Writer options in the package documentation.
+	OverviewBinSize int
+
+	// MeasureLoudness makes the file measure the integrated loudness of the
+	// samples, which IntegratedLoudness returns.  See Writer options in the
+	// package documentation.  If a bext chunk was set with
+	// SetBroadcastExtension, Close also writes the loudness to its
+	// LoudnessValue field.
+	MeasureLoudness bool
+
+	// Dither is the dither added to samples before they're quantized.  See
+	// Writer options in the package documentation.
+	Dither DitherMode
+
+	// Signed8Bit writes 8-bit samples as signed integers rather than the
+	// unsigned integers required by the WAV specification.  It's an escape
+	// hatch for legacy tools that expect signed data; other readers will
+	// decode such files incorrectly.
+	Signed8Bit bool
+
+	// AtomicAppend writes the sample data through a handle opened with
+	// O_APPEND.  The operating system then appends each write atomically, so
+	// several processes can add to the same recording without corrupting
+	// each other's bytes.  Each call to WriteChannels, WriteFrame or WriteBytes
+	// is a single write, so every call should hold whole frames.  The header
+	// is patched through a second handle.  The sizes are taken from the
+	// length of the file, so the last writer to close records the data of
+	// every writer.  Preallocate can't be used in this mode, and any Checksum
+	// only covers this writer's data.
+	AtomicAppend bool
+
+	// DataAlignment, if set, inserts a JUNK chunk before the data chunk so
+	// that the samples start at a multiple of DataAlignment bytes from the
+	// start of the file, such as 4096 for page alignment.  It must be even.
+	DataAlignment uint32
+
+	// ReserveDS64 writes a JUNK chunk straight after the RIFF header that's
+	// the size of an RF64 ds64 chunk, as EBU Tech 3306 recommends.  Tools can
+	// then turn the file into an RF64 file in place, and the layout of the
+	// headers is the same whatever size the file reaches.
+	ReserveDS64 bool
+
+	// CheckExtension makes the Open methods fail if the extension of the file
+	// name doesn't match the format.  See Writer options in the package
+	// documentation.
+	CheckExtension bool
+
+	// DeferSizes makes Close leave the RIFF and data chunk sizes unknown, so
+	// that a file which is repeatedly reopened with OpenAppend isn't patched
+	// on every close.  OpenAppend treats data of unknown size as running to
+	// the end of the file.  Call Finalize instead of Close the last time to
+	// patch the sizes; until then, most players see the file as empty.  Cue
+	// points can't be added in this mode, and UpdateInterval has no effect.
+	DeferSizes bool
+
 	file         *os.File
+	stream       io.Writer
+	borrowed     bool
+	header       *os.File
+	name         string
 	description  AudioDescription
 	bytesWritten uint32
+	lastUpdate   uint32
+	closed       bool
+	preallocated bool
+	scratch      bytes.Buffer
+	pending      resampleBuffer
+	gains        []float64
+	levels       levelMeter
+	overview     overview
+	loudness     loudnessMeter
+	dither       *ditherer
+	headerSize   uint32
+	factOffset   uint32
+	bext         []byte
+	bextOffset   uint32
+	cart         []byte
+	acid         []byte
+	loops        []SampleLoop
+	id3Tag       []byte
+	albumArt     []byte
+	monitor      io.Writer
+	sizeKnown    bool
+	frameCount   uint64
+	cues         []cuePoint
+	trailerSize  uint32
+	chunks       []Chunk
+	appendStart  uint32
+	finalizing   bool
 }
 
 // Open creates the file and writes the necessary headers.  The corresponding
@@ -19,295 +195,1963 @@ type WaveFile struct {
 func (w *WaveFile) Open(fileName string, description AudioDescription) error {
 	var err error
 
-	w.file, err = os.Create(fileName)
+	err = w.reset(description)
 	if err != nil {
 		return err
 	}
 
-	w.description = description
-
-	buffer := new(bytes.Buffer)
-	err = w.writeHeader(buffer)
+	err = w.checkExtension(fileName)
 	if err != nil {
 		return err
 	}
 
-	_, err = w.file.Write(buffer.Bytes())
-	return err
-}
+	w.name = fileName
+	w.file, err = os.Create(fileName)
+	if err != nil {
+		return err
+	}
 
-// WriteBytes writes the binary waveform to the file.  It expects muxed data
-// in the format specified by the audio description.  In most cases,
-// WriteChannels is more suitable because it will convert and mux the data for
-// you.  WriteBytes can be called several times, so long as the file doesn't
-// reach its 4GB limit.
-func (w *WaveFile) WriteBytes(bytes []byte) error {
-	n, err := w.file.Write(bytes)
-	w.bytesWritten += uint32(n)
-	return err
+	return w.start()
 }
 
-// WriteChannels muxes and writes the channels to the file.  Each channel
-// should be a float64 slice where each item in the array ranges from -1 to 1.
-// Any values beyond these bounds will be automatically clipped.  WriteChannels
-// can be called several times, so long as the file doesn't reach its 4GB
-// limit.
-func (w *WaveFile) WriteChannels(channels ...[]float64) error {
+// OpenWithFrameCount is like Open, but it takes the number of frames that
+// will be written, after any resampling.  The headers are written with their
+// final sizes, so they're never patched and the file can be written to a
+// destination that can't seek, such as a named pipe.  Close returns an error
+// if a different number of frames was written.
+func (w *WaveFile) OpenWithFrameCount(fileName string, description AudioDescription, frames uint64) error {
 	var err error
 
-	// If too many channels are given, return an error.
-	if len(channels) != int(w.description.NumChannels) {
-		return errors.New("The number of audio channels doesn't equal the number of streams supplied.")
+	err = w.reset(description)
+	if err != nil {
+		return err
 	}
 
-	// Make sure the data streams are all of the same length
-	var chanLength int = -1
-	for i := range channels {
-		if chanLength == -1 {
-			chanLength = len(channels[i])
-			continue
-		}
-
-		if len(channels[i]) != chanLength {
-			return errors.New("The channels have different amounts of audio data.")
-		}
+	err = w.checkExtension(fileName)
+	if err != nil {
+		return err
 	}
 
-	buffer := new(bytes.Buffer)
+	w.sizeKnown = true
+	w.frameCount = frames
+	if w.knownDataSize() > uint64(MaxFileSize(FormatWave)) {
+		return errors.New("The frame count is too large for a .wav file.")
+	}
 
-	// Write to the buffer
-	for i := 0; i < chanLength; i++ {
-		for j := range channels {
-			err = w.writeFloatToBuffer(channels[j][i], buffer)
-			if err != nil {
-				return err
-			}
-		}
+	w.name = fileName
+	w.file, err = os.Create(fileName)
+	if err != nil {
+		return err
 	}
 
-	return w.WriteBytes(buffer.Bytes())
+	return w.start()
 }
 
-// Close completes the headers and closes the file.  Close should always be
-// called when you're done writing data.
-func (w *WaveFile) Close() error {
+// OpenWriter writes the file to an io.Writer, such as os.Stdout, instead of a
+// named file.  If the writer is an *os.File that can seek and is positioned at
+// its start, the headers are completed as usual.  Otherwise the file is
+// written in streaming mode, with unknown sizes that are never patched, so it
+// can be played while it's being written, e.g. when piped to another
+// program.  Close doesn't close the writer.
+func (w *WaveFile) OpenWriter(writer io.Writer, description AudioDescription) error {
 	var err error
 
-	err = w.closeDataChunk()
+	err = w.reset(description)
 	if err != nil {
 		return err
 	}
 
-	err = w.closeRIFFChunk()
-	if err != nil {
-		return err
+	w.borrowed = true
+	if file, ok := writer.(*os.File); ok && seekableAtStart(file) {
+		w.file = file
+	} else {
+		w.stream = writer
 	}
 
-	return w.file.Close()
-}
-
-// AudioDescription acts as a getter for the AudioDescription provided to the
-// Open method.
-func (w *WaveFile) AudioDescription() AudioDescription {
-	return w.description
+	return w.start()
 }
 
-/*****************************************************************************/
-/****************************** Private Methods ******************************/
-/*****************************************************************************/
-
-// writeHeader writes the header chunks to the buffer.
-func (w *WaveFile) writeHeader(buffer *bytes.Buffer) error {
+// OpenContext is like Open, but it stops waiting for the file to be created
+// when the context is done, returning ctx.Err().  This bounds how long Open
+// can hang on a slow filesystem.  If the file is created after the context
+// is done, it's closed and removed.
+func (w *WaveFile) OpenContext(ctx context.Context, fileName string, description AudioDescription) error {
 	var err error
 
-	err = w.writeRIFFChunk(buffer)
+	err = w.reset(description)
 	if err != nil {
 		return err
 	}
 
-	err = w.writeFmtChunk(buffer)
+	err = w.checkExtension(fileName)
 	if err != nil {
 		return err
 	}
 
-	err = w.startDataChunk(buffer)
+	w.name = fileName
+	w.file, err = createContext(ctx, fileName)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return w.start()
 }
 
-// writeRIFFChunk writes the container (RIFF) chunk to the buffer.
-func (w *WaveFile) writeRIFFChunk(buffer *bytes.Buffer) error {
+// OpenAppend opens an existing .wav file so that more data can be written to
+// the end of it.  The data chunk must be the last chunk in the file.  If
+// description isn't the zero value, it's compared to the format of the file
+// and an error is returned if the channels, sample rate or bit depth differ.
+// Otherwise the file's own description is used.  Any Checksum only covers the
+// appended data.
+func (w *WaveFile) OpenAppend(fileName string, description AudioDescription) error {
 	var err error
 
-	// Chunk ID (RIFF)
-	_, err = buffer.WriteString("RIFF")
+	err = w.checkExtension(fileName)
 	if err != nil {
 		return err
 	}
 
-	// Chunk size (Unknown at this time)
-	err = binary.Write(buffer, binary.LittleEndian, uint32(0))
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0)
 	if err != nil {
 		return err
 	}
 
-	// Format (WAVE)
-	_, err = buffer.WriteString("WAVE")
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	layout, err := findWaveData(file, info.Size())
+	if err != nil {
+		file.Close()
+		return err
+	}
+	fileDescription := layout.description
+
+	if description == (AudioDescription{}) {
+		description = fileDescription
+	} else if !sameFormat(description, fileDescription) {
+		file.Close()
+		return fmt.Errorf("The description doesn't match the file, which has %d channels at %d Hz with %d bits per sample.",
+			fileDescription.NumChannels, fileDescription.SampleRate, fileDescription.validBits())
+	}
+
+	err = w.reset(description)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = w.resume(file, fileName, layout)
 	if err != nil {
+		file.Close()
+		w.file = nil
 		return err
 	}
 
 	return nil
 }
 
-// writeFmtChunk writes the mandatory fmt chunk to the buffer.
-func (w *WaveFile) writeFmtChunk(buffer *bytes.Buffer) error {
+// WriteBytes writes the binary waveform to the file.  It expects muxed data
+// in the format specified by the audio description.  In most cases,
+// WriteChannels is more suitable because it will convert and mux the data for
+// you.  WriteBytes can be called several times, so long as the file doesn't
+// reach its 4GB limit.  It returns ErrClosed if the file isn't open and a
+// *ShortWriteError if the data couldn't be written in full.
+func (w *WaveFile) WriteBytes(bytes []byte) error {
+	if !w.opened() {
+		return ErrClosed
+	}
+
+	if w.buffering() {
+		return errors.New("Raw bytes can't be resampled or limited; use WriteChannels instead.")
+	}
+
+	return w.writeData(bytes)
+}
+
+// DataWriter returns the data chunk as an io.WriteCloser, for use with io.Copy
+// and other code that expects a writer.  Write adds raw bytes to the data
+// chunk like WriteBytes, so a write that would take the file beyond its 4GB
+// limit fails without writing anything, and Close closes the file like Close.
+func (w *WaveFile) DataWriter() io.WriteCloser {
+	return dataWriter{writeBytes: w.WriteBytes, close: w.Close}
+}
+
+// WriteChannels muxes and writes the channels to the file.  Each channel
+// should be a float64 slice where each item in the array ranges from -1 to 1.
+// Any values beyond these bounds will be automatically clipped.  WriteChannels
+// can be called several times, so long as the file doesn't reach its 4GB
+// limit.  If every channel is empty, nothing is written; closing the file
+// afterwards still produces a valid file, with no audio data if none was
+// written before.
+func (w *WaveFile) WriteChannels(channels ...[]float64) error {
 	var err error
 
-	// Chunk ID (fmt )
-	_, err = buffer.WriteString("fmt ")
+	err = checkChannels(w.description, channels)
 	if err != nil {
 		return err
 	}
 
-	// Chunk size (always 16)
-	err = binary.Write(buffer, binary.LittleEndian, uint32(16))
+	// When resampling or limiting, the channels are buffered until Close.
+	if w.buffering() {
+		if !w.opened() {
+			return ErrClosed
+		}
+
+		w.pending.append(channels)
+		return nil
+	}
+
+	if isStereo16(w.description) && !w.inspectsSamples() {
+		return w.WriteBytes(encodeStereo16(channels[0], channels[1], binary.LittleEndian))
+	}
+
+	data, err := encodeChannels(channels, w.writeSampleToBuffer)
 	if err != nil {
 		return err
 	}
 
-	// Audio format (1 = uncompressed PCM)
-	err = binary.Write(buffer, binary.LittleEndian, uint16(1))
+	return w.WriteBytes(data)
+}
+
+// WriteComplex writes complex samples, such as the I/Q data of a software
+// defined radio, to a stereo file.  The real part (I) of each sample is
+// written to channel 0 and the imaginary part (Q) to channel 1.  The file
+// must have been opened with 2 channels.
+func (w *WaveFile) WriteComplex(samples []complex128) error {
+	return writeComplex(w, samples)
+}
+
+// WriteChannels2D is like WriteChannels, but it takes the channels as a single
+// slice, which suits code with a dynamic number of channels.
+func (w *WaveFile) WriteChannels2D(channels [][]float64) error {
+	return w.WriteChannels(channels...)
+}
+
+// WriteChannelsInt32 muxes and writes integer channels to the file without
+// converting them to floats.  The samples are treated as left-justified, so a
+// full-scale sample spans the entire int32 range.  This is how most hardware
+// delivers 24-bit data in 32-bit containers.  For 24-bit files, the most
+// significant 24 bits of each sample are written and the low byte is
+// discarded.  WriteChannelsInt32 is only supported for 24- and 32-bit files.
+func (w *WaveFile) WriteChannelsInt32(channels ...[]int32) error {
+	var err error
+
+	bits := w.description.containerBits()
+	if w.description.isFloat() || (bits != BPS24 && bits != BPS32) {
+		return errors.New("Integer channels can only be written to 24- or 32-bit files.")
+	}
+
+	err = checkChannels(w.description, channels)
 	if err != nil {
 		return err
 	}
 
-	// Number of channels
-	err = binary.Write(buffer, binary.LittleEndian, w.description.NumChannels)
+	buffer := new(bytes.Buffer)
+
+	// Write to the buffer
+	for i := 0; i < len(channels[0]); i++ {
+		for j := range channels {
+			err = encodeInt32(channels[j][i], w.description, binary.LittleEndian, buffer)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return w.WriteBytes(buffer.Bytes())
+}
+
+// WriteFrame writes a single frame, taking one sample per channel.  It's the
+// per-frame complement to WriteChannels and reuses an internal buffer, so it
+// doesn't allocate on each call.
+func (w *WaveFile) WriteFrame(sample ...float64) error {
+	var err error
+
+	// If too many samples are given, return an error.
+	if len(sample) != int(w.description.NumChannels) {
+		return &ChannelCountError{Expected: int(w.description.NumChannels), Actual: len(sample)}
+	}
+
+	// When resampling or limiting, the frame is buffered until Close.
+	if w.buffering() {
+		if !w.opened() {
+			return ErrClosed
+		}
+
+		w.pending.appendFrame(sample)
+		return nil
+	}
+
+	w.scratch.Reset()
+	for i := range sample {
+		err = w.writeSampleToBuffer(sample[i], i, 0, &w.scratch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.WriteBytes(w.scratch.Bytes())
+}
+
+// WriteSilence writes the number of frames of silence corresponding to the
+// given duration at the description's sample rate.
+func (w *WaveFile) WriteSilence(d time.Duration) error {
+	return writeSilence(w, w.description.DurationToFrame(d))
+}
+
+// Close completes the headers and closes the file.  Close should always be
+// called when you're done writing data.
+func (w *WaveFile) Close() error {
+	var err error
+
+	if !w.opened() {
+		return ErrClosed
+	}
+
+	// A failed flush can't be retried, so the file is closed regardless.
+	if w.buffering() {
+		err = w.flushPending()
+		if err != nil {
+			w.closed = true
+			w.release()
+			return err
+		}
+	}
+	w.closed = true
+
+	err = w.countAppended()
 	if err != nil {
 		return err
 	}
+	dataSize := w.bytesWritten
 
-	// Sample rate
-	err = binary.Write(buffer, binary.LittleEndian, w.description.SampleRate)
+	err = w.padDataChunk()
 	if err != nil {
 		return err
 	}
 
-	blockAlign := w.description.NumChannels * w.description.BitsPerSample / 8
-	byteRate := w.description.SampleRate * uint32(blockAlign)
+	if w.patchesSizes() || w.finalizing {
+		err = w.updateSizes()
+		if err != nil {
+			return err
+		}
+	}
 
-	// Byte rate
-	err = binary.Write(buffer, binary.LittleEndian, byteRate)
+	err = w.writeTrailingChunks()
 	if err != nil {
 		return err
 	}
 
-	// Block align
-	err = binary.Write(buffer, binary.LittleEndian, blockAlign)
+	err = w.writeLoudness()
 	if err != nil {
 		return err
 	}
 
-	// Bits per sample
-	err = binary.Write(buffer, binary.LittleEndian, w.description.BitsPerSample)
-	if err != nil {
-		return err
+	if w.preallocated {
+		err = truncateToPosition(w.file)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
-}
+	if w.borrowed {
+		return nil
+	}
 
-// startDataChunk writes the start of the data chunk to the buffer.
-func (w *WaveFile) startDataChunk(buffer *bytes.Buffer) error {
-	var err error
+	if w.header != nil {
+		err = w.header.Close()
+		if err != nil {
+			w.file.Close()
+			return err
+		}
+	}
 
-	// Chunk ID (data)
-	_, err = buffer.WriteString("data")
+	err = w.file.Close()
 	if err != nil {
 		return err
 	}
 
-	// Chunk size (unknown at this time)
-	err = binary.Write(buffer, binary.LittleEndian, uint32(0))
-	if err != nil {
-		return err
+	if w.WriteSidecar {
+		err = w.writeSidecar()
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return w.checkFrameCount(dataSize)
 }
 
-// closeDataChunk writes the size of the data chunk to its header.
-func (w *WaveFile) closeDataChunk() error {
-	var err error
+// Finalize is like Close, but it patches the sizes in the header even if
+// DeferSizes is set.  It's meant for the last close of a file that's
+// appended to many times.
+func (w *WaveFile) Finalize() error {
+	if !w.opened() {
+		return ErrClosed
+	}
 
-	buffer := new(bytes.Buffer)
-	err = binary.Write(buffer, binary.LittleEndian, w.bytesWritten)
+	// Streamed sizes are never patched.
+	w.finalizing = w.DeferSizes && !w.streaming() && !w.sizeKnown
+	return w.Close()
+}
+
+// CloseInfo is like Close, but it also returns the path of the finished file
+// and its size in bytes, which is convenient for logging.
+func (w *WaveFile) CloseInfo() (string, int64, error) {
+	err := w.Close()
 	if err != nil {
-		return err
+		return "", 0, err
 	}
 
-	// The offset of the size of the data chunk is always 40 bytes.
-	_, err = w.file.WriteAt(buffer.Bytes(), 40)
-	if err != nil {
-		return err
+	// Files written with OpenWriter have no path, so their size is the
+	// number of bytes written to the writer.
+	if w.name == "" {
+		return "", int64(w.headerSize) + int64(w.bytesWritten), nil
 	}
 
-	return nil
+	return fileInfo(w.name)
 }
 
-// closeRIFFChunk writes the size of the RIFF chunk to its header.
-func (w *WaveFile) closeRIFFChunk() error {
-	var err error
+// Preallocate extends the file to the size it will have once the given number
+// of frames has been written, which avoids fragmentation on some filesystems.
+// The data written afterwards fills the reserved space, and Close truncates the
+// file if fewer frames were written.  It must be called after Open, and it
+// returns an error if more frames have already been written.
+func (w *WaveFile) Preallocate(frames uint64) error {
+	if !w.opened() {
+		return ErrClosed
+	}
 
-	buffer := new(bytes.Buffer)
-	err = binary.Write(buffer, binary.LittleEndian, w.bytesWritten+36)
+	if w.header != nil {
+		return errors.New("Files written with AtomicAppend can't be preallocated.")
+	}
+	if w.file == nil {
+		return errors.New("Only seekable files can be preallocated.")
+	}
+
+	if frames < uint64(w.bytesWritten)/uint64(w.frameSize()) {
+		return errors.New("Fewer frames can't be preallocated than have already been written.")
+	}
+
+	size, err := preallocatedSize(FormatWave, w.description, int64(w.headerSize), frames)
 	if err != nil {
 		return err
 	}
 
-	// The offset of the size of the RIFF chunk is always 4 bytes.
-	_, err = w.file.WriteAt(buffer.Bytes(), 4)
+	err = w.file.Truncate(size)
 	if err != nil {
 		return err
 	}
 
+	w.preallocated = true
 	return nil
 }
 
-// writeFloatToBuffer determines which method to call in order to write the
-// data to the buffer at the right bit depth.
-func (w *WaveFile) writeFloatToBuffer(data float64, buffer *bytes.Buffer) error {
-	switch w.description.BitsPerSample {
-	case BPS8:
-		return w.write8BitToBuffer(data, buffer)
-	case BPS16:
-		return w.write16BitToBuffer(data, buffer)
-	case BPS32:
-		return w.write32BitToBuffer(data, buffer)
-	default:
-		return errors.New("Invalid bit depth.")
+// PatchHeader overwrites part of the headers that precede the sample data,
+// such as to inject a field written by another application.  The write must
+// lie entirely within the headers, so it can't overwrite samples.  The chunk
+// sizes and frame counts are still rewritten by Close.
+func (w *WaveFile) PatchHeader(offset int64, data []byte) error {
+	if !w.opened() {
+		return ErrClosed
 	}
-	return nil
+
+	if offset < 0 || offset+int64(len(data)) > int64(w.headerSize) {
+		return errors.New("The patch extends beyond the header.")
+	}
+	if w.file == nil {
+		return errors.New("The header of a stream can't be patched.")
+	}
+
+	_, err := w.headerFile().WriteAt(data, offset)
+	return err
+}
+
+// AudioDescription acts as a getter for the AudioDescription provided to the
+// Open method.
+func (w *WaveFile) AudioDescription() AudioDescription {
+	return w.description
 }
 
-// write8BitToBuffer writes an 8-bit unsigned integer to the buffer.
-func (w *WaveFile) write8BitToBuffer(data float64, buffer *bytes.Buffer) error {
-	res := uint8(data*127 + 127)
-	return binary.Write(buffer, binary.LittleEndian, res)
+// IntegratedLoudness returns the integrated loudness in LUFS of the samples
+// written so far, measured when MeasureLoudness is set.  It returns NaN if the
+// loudness wasn't measured and negative infinity if the file is silent or
+// shorter than 400ms.
+func (w *WaveFile) IntegratedLoudness() float64 {
+	if !w.MeasureLoudness {
+		return math.NaN()
+	}
+	return w.loudness.integrated()
 }
 
-// write16BitToBuffer writes a 16-bit integer to the buffer.
-func (w *WaveFile) write16BitToBuffer(data float64, buffer *bytes.Buffer) error {
-	res := int16(data * 32767)
-	return binary.Write(buffer, binary.LittleEndian, res)
+// WaveformOverview returns the overview recorded with OverviewBinSize, with
+// the minimum and maximum of each channel over every binSize frames.  binSize
+// must be a multiple of OverviewBinSize, which lets several zoom levels be
+// drawn from one recording.  The last bin may cover fewer frames.  It returns
+// nil if no overview was recorded or binSize isn't a multiple.
+func (w *WaveFile) WaveformOverview(binSize int) [][]MinMax {
+	return w.overview.merge(binSize)
 }
 
-// write32BitToBuffer writes a 32-bit integer to the buffer.
-func (w *WaveFile) write32BitToBuffer(data float64, buffer *bytes.Buffer) error {
-	res := int32(data * 2147483647)
-	return binary.Write(buffer, binary.LittleEndian, res)
+// DataChecksum returns the checksum of the data written so far, excluding the
+// headers.  It returns nil if no Checksum was set.
+func (w *WaveFile) DataChecksum() []byte {
+	if w.Checksum == nil {
+		return nil
+	}
+	return w.Checksum.Sum(nil)
+}
+
+// Verify flushes the file to disk, reads back the data written so far and
+// compares its checksum with DataChecksum, which catches silent corruption.
+// It requires a Checksum and is expensive, since it rereads all of the data,
+// so it's best kept for critical masters.  If the checksums differ, the
+// Checksum afterwards describes the data on disk.  Verify must be called
+// before Close and can't be used with OpenWriter or AtomicAppend.
+func (w *WaveFile) Verify() error {
+	var err error
+
+	if !w.opened() {
+		return ErrClosed
+	}
+
+	if w.Checksum == nil {
+		return errors.New("Verify requires a Checksum.")
+	}
+
+	if w.borrowed || w.AtomicAppend {
+		return errors.New("Only files written by a single WaveFile can be verified.")
+	}
+
+	err = w.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	// Rehashing the same data leaves the checksum in the state it had, so it
+	// can be reused rather than needing a second hash.
+	expected := w.Checksum.Sum(nil)
+	w.Checksum.Reset()
+
+	start := int64(w.headerSize) + int64(w.appendStart)
+	data := io.NewSectionReader(w.file, start, int64(w.bytesWritten-w.appendStart))
+	_, err = io.Copy(w.Checksum, data)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(w.Checksum.Sum(nil), expected) {
+		return errors.New("The data read back from the file doesn't match its checksum.")
+	}
+
+	return nil
+}
+
+// SetBroadcastExtension sets the fields of a bext chunk, which makes the file
+// a Broadcast Wave Format file.  The chunk is written between the fmt and data
+// chunks, so SetBroadcastExtension must be called before Open.
+func (w *WaveFile) SetBroadcastExtension(bext *BroadcastExtension) error {
+	body, err := bext.encode()
+	if err != nil {
+		return err
+	}
+
+	w.bext = body
+	return nil
+}
+
+// SetChunks sets chunks to write verbatim, such as the Chunks of a decoded
+// file, which preserves its metadata through an edit.  Chunks that followed
+// the data chunk are written after the new data when the file is closed, and
+// the others are written with the headers, so SetChunks must be called before
+// Open.  In streaming mode and with OpenWithFrameCount, every chunk is
+// written with the headers.  Chunks that duplicate ones the WaveFile writes
+// itself, such as a bext chunk along with SetBroadcastExtension, are written
+// twice.
+func (w *WaveFile) SetChunks(chunks []Chunk) error {
+	for _, chunk := range chunks {
+		if len(chunk.ID) != 4 {
+			return errors.New("Chunk IDs must be 4 characters long.")
+		}
+
+		if !preservedChunk(chunk.ID) || chunk.ID == "RIFF" {
+			return fmt.Errorf("The %q chunk is written by the WaveFile itself.", chunk.ID)
+		}
+	}
+
+	w.chunks = append([]Chunk(nil), chunks...)
+	return nil
+}
+
+// SetChannelGains sets a linear gain for each channel, such as to trim the
+// LFE channel, which is applied to every sample given to WriteChannels or
+// WriteFrame before it's clamped.  It multiplies with any gain already applied
+// to the samples, e.g. one from DBToLinear.  The number of gains must equal
+// the number of channels, so it must be called after Open, and the gains are
+// cleared when the file is opened again.
+func (w *WaveFile) SetChannelGains(gains []float64) error {
+	if len(gains) != int(w.description.NumChannels) {
+		return errors.New("The number of gains doesn't equal the number of audio channels.")
+	}
+
+	w.gains = append([]float64(nil), gains...)
+	return nil
+}
+
+// SetCart sets the fields of an AES46 cart chunk for radio automation
+// systems.  Like the bext chunk, it's written before the data chunk, so SetCart
+// must be called before Open.
+func (w *WaveFile) SetCart(cart *CartChunk) error {
+	body, err := cart.encode()
+	if err != nil {
+		return err
+	}
+
+	w.cart = body
+	return nil
+}
+
+// SetAcid sets the fields of an acid chunk, which lets loop-based hosts
+// time-stretch the file to the tempo of a project.  It's written before the
+// data chunk, so SetAcid must be called before Open.
+func (w *WaveFile) SetAcid(acid *AcidMetadata) error {
+	body, err := acid.encode()
+	if err != nil {
+		return err
+	}
+
+	w.acid = body
+	return nil
+}
+
+// SetSampleLoops sets the loops of a smpl chunk, which samplers and game
+// engines use to repeat part of the file.  It's written before the data
+// chunk, so SetSampleLoops must be called before Open.  The loop points are
+// frames at the sample rate of the description; if TargetSampleRate
+// resamples the file, they're scaled to match.  WriteLoopFile also aligns a
+// loop to zero crossings.
+func (w *WaveFile) SetSampleLoops(loops []SampleLoop) error {
+	for _, loop := range loops {
+		if loop.End < loop.Start {
+			return errors.New("A loop must not end before it starts.")
+		}
+	}
+
+	w.loops = append([]SampleLoop(nil), loops...)
+	return nil
+}
+
+// SetID3 sets an ID3v2 tag, which is written to an id3 chunk before the data
+// chunk, so SetID3 must be called before Open.  The tag must be complete,
+// starting with its 10-byte header.
+func (w *WaveFile) SetID3(tag []byte) error {
+	if len(tag) < 10 || string(tag[0:3]) != "ID3" {
+		return errors.New("The ID3 tag must start with an ID3v2 header.")
+	}
+
+	_, err := buildID3(tag, w.albumArt)
+	if err != nil {
+		return err
+	}
+
+	w.id3Tag = append([]byte(nil), tag...)
+	return nil
+}
+
+// SetAlbumArt sets a JPEG or PNG image to embed as the front cover, in an
+// APIC frame of the id3 chunk.  The frame is added to any tag given to SetID3,
+// or to a new ID3v2.3 tag.  The image can't be larger than MaxAlbumArtSize,
+// and SetAlbumArt must be called before Open.
+func (w *WaveFile) SetAlbumArt(image []byte) error {
+	err := validateAlbumArt(image)
+	if err != nil {
+		return err
+	}
+
+	_, err = buildID3(w.id3Tag, image)
+	if err != nil {
+		return err
+	}
+
+	w.albumArt = append([]byte(nil), image...)
+	return nil
+}
+
+// SetMonitor sets a writer, such as a ring buffer feeding a live output, that
+// receives a copy of the muxed sample data as it's written to the file.  The
+// monitor must not block.  Its errors are ignored so that monitoring can't
+// interrupt the recording.  A nil writer removes the monitor.
+func (w *WaveFile) SetMonitor(monitor io.Writer) {
+	w.monitor = monitor
+}
+
+// AddCue adds a cue point at the given frame, counted from the start of the
+// file, with an optional label.  The cue points are written to a cue chunk
+// and their labels to a LIST/adtl chunk when the file is closed.  It must be
+// called after Open, and the cue points are cleared when the file is opened
+// again.  Cue points can't be added in streaming mode or with
+// OpenWithFrameCount, since the chunks follow the data.
+func (w *WaveFile) AddCue(frame uint64, label string) error {
+	if !w.opened() {
+		return ErrClosed
+	}
+
+	if w.streaming() || w.sizeKnown {
+		return errors.New("Cue points can't be added when the sizes are written up front.")
+	}
+
+	if w.DeferSizes {
+		return errors.New("Cue points can't be added when the sizes are deferred.")
+	}
+
+	cue, err := newCuePoint(frame, label)
+	if err != nil {
+		return err
+	}
+
+	w.cues = append(w.cues, cue)
+	return nil
+}
+
+// AddCueAt is like AddCue, but it takes the time of the cue point, which is
+// rounded to the nearest frame at the description's sample rate.
+func (w *WaveFile) AddCueAt(t time.Duration, label string) error {
+	return w.AddCue(w.description.DurationToFrame(t), label)
+}
+
+// FinalizeStream patches the sizes of a complete .wav file that was written
+// with placeholder sizes, such as by a WaveFile with Streaming set, so that
+// every player can read it.  The placeholders must be 0 or 0xFFFFFFFF, and
+// the data chunk must be the last chunk.  The data runs to the end of the
+// stream, with any partial frame left outside the data chunk.  Running it on
+// a file whose sizes are already correct rewrites the same values.
+func FinalizeStream(rw io.ReadWriteSeeker) error {
+	var err error
+
+	size, err := rw.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	_, err = rw.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	layout, err := findWaveData(rw, size)
+	if err != nil {
+		return err
+	}
+
+	riffSize := layout.dataStart - 8 + int64(layout.dataSize) + int64(layout.dataSize%2)
+	if riffSize > math.MaxUint32 {
+		return errors.New("The data would exceed the maximum size of a .wav file.")
+	}
+
+	put := func(offset int64, value uint32) error {
+		_, err := rw.Seek(offset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		return binary.Write(rw, binary.LittleEndian, value)
+	}
+
+	err = put(4, uint32(riffSize))
+	if err != nil {
+		return err
+	}
+
+	err = put(layout.dataStart-4, layout.dataSize)
+	if err != nil {
+		return err
+	}
+
+	if layout.factOffset != 0 {
+		frameSize := uint32(layout.description.NumChannels) * uint32(layout.description.containerBits()) / 8
+		err = put(layout.factOffset, layout.dataSize/frameSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*****************************************************************************/
+/****************************** Private Methods ******************************/
+/*****************************************************************************/
+
+// reset prepares the file to be opened with the given description and
+// validates the options.
+func (w *WaveFile) reset(description AudioDescription) error {
+	if description.NumChannels <= 0 {
+		return errors.New("The description must have at least one channel.")
+	}
+
+	w.description = description
+	w.closed = false
+	w.preallocated = false
+	w.bytesWritten = 0
+	w.lastUpdate = 0
+	w.factOffset = 0
+	w.bextOffset = 0
+	w.headerSize = 0
+	w.frameCount = 0
+	w.pending.reset(description.NumChannels)
+	w.gains = nil
+	w.header = nil
+	w.stream = nil
+	w.borrowed = false
+	w.sizeKnown = false
+	w.cues = nil
+	w.trailerSize = 0
+	w.appendStart = 0
+	w.finalizing = false
+	w.levels = levelMeter{}
+	w.overview.reset(description.NumChannels, w.OverviewBinSize)
+	w.loudness.reset(0, 0)
+	dither, err := newWriterDitherer(w.Dither, description, !w.Signed8Bit)
+	if err != nil {
+		return err
+	}
+	w.dither = dither
+	if w.MeasureLoudness {
+		w.loudness.reset(description.NumChannels, w.outputSampleRate())
+	}
+
+	if w.Checksum != nil {
+		w.Checksum.Reset()
+	}
+
+	if w.PadToBlock != 0 && (w.frameSize() == 0 || w.PadToBlock%w.frameSize() != 0) {
+		return errors.New("PadToBlock must be a multiple of the frame size.")
+	}
+
+	if description.isFloat() && description.containerBits() != BPS32 && description.containerBits() != BPS64 {
+		return errors.New("Floating-point samples must be 32 or 64 bits.")
+	}
+
+	if w.Dither < DitherNone || w.Dither > DitherNoiseShaped {
+		return errors.New("Invalid dither mode.")
+	}
+
+	if w.OverviewBinSize < 0 {
+		return errors.New("OverviewBinSize can't be negative.")
+	}
+
+	if w.DataAlignment%2 != 0 {
+		return errors.New("DataAlignment must be even.")
+	}
+
+	if w.Ambisonic && (description.NumChannels < 3 || description.NumChannels > 16) {
+		return errors.New("Ambisonic files must have between 3 and 16 channels.")
+	}
+
+	return nil
+}
+
+// waveLayout describes where the parts of an existing .wav file are stored.
+type waveLayout struct {
+	description AudioDescription
+	dataStart   int64
+	dataSize    uint32
+	factOffset  int64 // The offset of the fact chunk's frame count, or 0
+	sized       bool  // Whether the header records the size of the data
+}
+
+// findWaveData reads the headers of an existing .wav file and returns its
+// layout.  The data chunk must be the last chunk of the file.
+func findWaveData(file io.ReadSeeker, fileSize int64) (waveLayout, error) {
+	var layout waveLayout
+
+	header := make([]byte, 12)
+	_, err := io.ReadFull(file, header)
+	if err != nil {
+		return layout, err
+	}
+
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return layout, errors.New("Only little-endian WAVE files can be appended to.")
+	}
+
+	offset := int64(12)
+	haveFmt := false
+
+	for {
+		id, size, err := readChunkHeader(file, binary.LittleEndian)
+		if err == io.EOF {
+			return layout, errors.New("The file has no data chunk.")
+		}
+		if err != nil {
+			return layout, err
+		}
+		offset += 8
+
+		switch id {
+		case "fmt ":
+			body, err := readChunkBody(file, size, fileSize-offset)
+			if err != nil {
+				return layout, err
+			}
+
+			layout.description, err = parseFmtChunk(body, binary.LittleEndian)
+			if err != nil {
+				return layout, err
+			}
+			haveFmt = true
+		case "fact":
+			layout.factOffset = offset
+			_, err = file.Seek(int64(size+size%2), io.SeekCurrent)
+			if err != nil {
+				return layout, err
+			}
+		case "data":
+			if !haveFmt {
+				return layout, errors.New("The data chunk appears before the fmt chunk.")
+			}
+
+			// A size of 0xFFFFFFFF means the file was streamed, and a size of
+			// 0 that isn't followed by other chunks means it was never
+			// closed, so the data runs to the end of the file.  A closed
+			// file without samples can have chunks after an empty data
+			// chunk, which must not be taken for samples.
+			remaining := fileSize - offset
+			unsized := size == 0xFFFFFFFF
+			if size == 0 && remaining > 0 {
+				follows, err := followedByChunks(file, remaining)
+				if err != nil {
+					return layout, err
+				}
+				unsized = !follows
+			}
+
+			if unsized {
+				frameSize := int64(layout.description.NumChannels) * int64(layout.description.containerBits()) / 8
+				size = uint32(remaining / frameSize * frameSize)
+			} else if remaining < int64(size) || remaining > int64(size)+1 {
+				return layout, errors.New("The data chunk isn't the last chunk in the file.")
+			} else {
+				layout.sized = true
+			}
+
+			layout.dataStart = offset
+			layout.dataSize = size
+			return layout, nil
+		default:
+			_, err = file.Seek(int64(size+size%2), io.SeekCurrent)
+			if err != nil {
+				return layout, err
+			}
+		}
+
+		offset += int64(size + size%2)
+	}
+}
+
+// followedByChunks returns whether the remaining bytes of the file, from the
+// current position, form a sequence of chunks that ends exactly at the end of
+// the file.  The position is restored afterwards.
+func followedByChunks(file io.ReadSeeker, remaining int64) (bool, error) {
+	start, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+
+	follows := true
+	for offset := int64(0); offset < remaining; {
+		id, size, err := readChunkHeader(file, binary.LittleEndian)
+		if err != nil || !validChunkID(id) {
+			follows = false
+			break
+		}
+
+		offset += 8 + int64(size) + int64(size%2)
+		if offset > remaining+1 {
+			follows = false
+			break
+		}
+
+		_, err = file.Seek(start+offset, io.SeekStart)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = file.Seek(start, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+
+	return follows, nil
+}
+
+// validChunkID returns whether id is made of printable ASCII characters, as
+// the IDs of RIFF chunks are.
+func validChunkID(id string) bool {
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x20 || id[i] > 0x7E {
+			return false
+		}
+	}
+	return len(id) == 4
+}
+
+// sameFormat returns whether the descriptions store samples the same way.
+func sameFormat(a, b AudioDescription) bool {
+	return a.NumChannels == b.NumChannels &&
+		a.SampleRate == b.SampleRate &&
+		a.Format == b.Format &&
+		a.containerBits() == b.containerBits() &&
+		a.validBits() == b.validBits()
+}
+
+// start writes the headers to the newly created file.
+func (w *WaveFile) start() error {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	err = w.writeHeader(buffer)
+	if err != nil {
+		return err
+	}
+	w.headerSize = uint32(buffer.Len())
+
+	if w.sizeKnown {
+		w.fillSizes(buffer.Bytes(), uint32(w.knownDataSize()))
+	}
+
+	_, err = w.writer().Write(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if w.AtomicAppend && !w.borrowed {
+		return w.startAppending()
+	}
+
+	return nil
+}
+
+// startAppending moves the data writes to a new handle opened with O_APPEND
+// and keeps the current handle for patching the header, since WriteAt can't
+// be used on a file opened with O_APPEND.
+func (w *WaveFile) startAppending() error {
+	file, err := os.OpenFile(w.file.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+
+	w.header = w.file
+	w.file = file
+	return nil
+}
+
+// resume prepares an existing file with the given layout for more data to be
+// appended to it.
+func (w *WaveFile) resume(file *os.File, fileName string, layout waveLayout) error {
+	var err error
+
+	w.file = file
+	w.name = fileName
+	w.headerSize = uint32(layout.dataStart)
+	w.factOffset = uint32(layout.factOffset)
+	w.bytesWritten = layout.dataSize
+	w.lastUpdate = layout.dataSize
+	w.appendStart = layout.dataSize
+
+	// Sizes left in the header would no longer match once data is added
+	// without patching them, so they're cleared the first time.
+	if w.DeferSizes && layout.sized {
+		err = w.clearSizes()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Drop any pad byte after the data so the new data follows it directly.
+	end := layout.dataStart + int64(layout.dataSize)
+	err = file.Truncate(end)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Seek(end, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	if w.AtomicAppend {
+		return w.startAppending()
+	}
+
+	return nil
+}
+
+// checkExtension checks the extension of the file name if CheckExtension is
+// set.  Ambisonic files may also use .amb.
+func (w *WaveFile) checkExtension(fileName string) error {
+	if !w.CheckExtension {
+		return nil
+	}
+
+	extensions := FileExtensions(FormatWave)
+	if w.Ambisonic {
+		extensions = append(extensions, ".amb")
+	}
+	return checkExtension(fileName, extensions...)
+}
+
+// release closes the files that the WaveFile opened itself, ignoring any
+// errors, after a failure that leaves the file unfinished.
+func (w *WaveFile) release() {
+	if w.borrowed {
+		return
+	}
+
+	if w.header != nil {
+		w.header.Close()
+	}
+	w.file.Close()
+}
+
+// opened returns whether the file is open for writing.
+func (w *WaveFile) opened() bool {
+	return !w.closed && (w.file != nil || w.stream != nil)
+}
+
+// writer returns the destination of the headers and data.
+func (w *WaveFile) writer() io.Writer {
+	if w.stream != nil {
+		return w.stream
+	}
+	return w.file
+}
+
+// streaming returns whether the sizes are left unknown, either because the
+// Streaming option is set or because the writer can't seek.
+func (w *WaveFile) streaming() bool {
+	return w.Streaming || w.stream != nil
+}
+
+// patchesSizes returns whether the sizes in the header are patched as the
+// data is written, which isn't needed when they're written up front.  When
+// they're deferred, only Finalize patches them.
+func (w *WaveFile) patchesSizes() bool {
+	return !w.streaming() && !w.sizeKnown && !w.DeferSizes
+}
+
+// headerFile returns the handle used to patch the header.
+func (w *WaveFile) headerFile() *os.File {
+	if w.header != nil {
+		return w.header
+	}
+	return w.file
+}
+
+// countAppended sets the number of bytes written to the size of the data in
+// the file, which includes the data of other writers when appending
+// atomically.
+func (w *WaveFile) countAppended() error {
+	if w.header == nil {
+		return nil
+	}
+
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.bytesWritten = uint32(info.Size() - int64(w.headerSize))
+	return nil
+}
+
+// writeHeader writes the header chunks to the buffer.
+func (w *WaveFile) writeHeader(buffer *bytes.Buffer) error {
+	var err error
+
+	err = w.writeRIFFChunk(buffer)
+	if err != nil {
+		return err
+	}
+
+	if w.ReserveDS64 {
+		err = w.writeChunk(buffer, "JUNK", make([]byte, ds64Size))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.writeFmtChunk(buffer)
+	if err != nil {
+		return err
+	}
+
+	// Formats other than PCM must include a fact chunk holding the number of
+	// frames, which is patched when the file is closed.
+	w.factOffset = 0
+	if w.description.isFloat() {
+		w.factOffset = uint32(buffer.Len()) + 8
+		err = w.writeChunk(buffer, "fact", []byte{0xFF, 0xFF, 0xFF, 0xFF})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.bextOffset = 0
+	if w.bext != nil {
+		w.bextOffset = uint32(buffer.Len()) + 8
+		err = w.writeChunk(buffer, "bext", w.bext)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.cart != nil {
+		err = w.writeChunk(buffer, "cart", w.cart)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.acid != nil {
+		err = w.writeChunk(buffer, "acid", w.acid)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.loops != nil {
+		smpl, err := encodeSampleChunk(w.outputLoops(), w.outputRate())
+		if err != nil {
+			return err
+		}
+
+		err = w.writeChunk(buffer, "smpl", smpl)
+		if err != nil {
+			return err
+		}
+	}
+
+	tag, err := buildID3(w.id3Tag, w.albumArt)
+	if err != nil {
+		return err
+	}
+
+	if tag != nil {
+		err = w.writeChunk(buffer, "id3 ", tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, chunk := range w.chunks {
+		if chunk.AfterData && w.patchesSizes() {
+			continue
+		}
+
+		err = w.writeChunk(buffer, chunk.ID, chunk.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.DataAlignment != 0 {
+		err = w.writeJunkChunk(buffer)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.startDataChunk(buffer)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writeRIFFChunk writes the container (RIFF) chunk to the buffer.
+func (w *WaveFile) writeRIFFChunk(buffer *bytes.Buffer) error {
+	var err error
+
+	// Chunk ID (RIFF)
+	_, err = buffer.WriteString("RIFF")
+	if err != nil {
+		return err
+	}
+
+	// Chunk size (Unknown at this time)
+	err = binary.Write(buffer, binary.LittleEndian, w.unknownSize())
+	if err != nil {
+		return err
+	}
+
+	// Format (WAVE)
+	_, err = buffer.WriteString("WAVE")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writeFmtChunk writes the mandatory fmt chunk to the buffer.
+func (w *WaveFile) writeFmtChunk(buffer *bytes.Buffer) error {
+	var err error
+
+	// Chunk ID (fmt )
+	_, err = buffer.WriteString("fmt ")
+	if err != nil {
+		return err
+	}
+
+	// Chunk size (16, 18 for the extended form or 40 for the extensible form)
+	var chunkSize uint32 = 16
+	if w.extensible() {
+		chunkSize = 40
+	} else if w.extendedFmt() {
+		chunkSize = 18
+	}
+	err = binary.Write(buffer, binary.LittleEndian, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	// Audio format (1 = uncompressed PCM, 3 = IEEE float, 0xFFFE = extensible)
+	var audioFormat uint16 = 1
+	if w.extensible() {
+		audioFormat = 0xFFFE
+	} else if w.description.isFloat() {
+		audioFormat = 3
+	}
+	err = binary.Write(buffer, binary.LittleEndian, audioFormat)
+	if err != nil {
+		return err
+	}
+
+	// Number of channels
+	err = binary.Write(buffer, binary.LittleEndian, w.description.NumChannels)
+	if err != nil {
+		return err
+	}
+
+	// Sample rate
+	err = binary.Write(buffer, binary.LittleEndian, w.outputSampleRate())
+	if err != nil {
+		return err
+	}
+
+	// Compute the block align and byte rate using wide integers so that large
+	// channel counts and sample rates can't silently overflow the fields.
+	blockAlign := int64(w.description.NumChannels) * int64(w.description.containerBits()) / 8
+	if blockAlign > math.MaxUint16 {
+		return errors.New("The block align is too large to be stored in the fmt chunk.")
+	}
+
+	byteRate := int64(w.outputSampleRate()) * blockAlign
+	if byteRate > math.MaxUint32 {
+		return errors.New("The byte rate is too large to be stored in the fmt chunk.")
+	}
+
+	// Byte rate
+	err = binary.Write(buffer, binary.LittleEndian, uint32(byteRate))
+	if err != nil {
+		return err
+	}
+
+	// Block align
+	err = binary.Write(buffer, binary.LittleEndian, uint16(blockAlign))
+	if err != nil {
+		return err
+	}
+
+	// Bits per sample
+	err = binary.Write(buffer, binary.LittleEndian, w.description.containerBits())
+	if err != nil {
+		return err
+	}
+
+	if w.extensible() {
+		return w.writeFmtExtension(buffer)
+	}
+
+	// Size of the extension (always 0 for PCM and IEEE float)
+	if w.extendedFmt() {
+		err = binary.Write(buffer, binary.LittleEndian, uint16(0))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFmtExtension writes the extension of the extensible fmt chunk to the
+// buffer.
+func (w *WaveFile) writeFmtExtension(buffer *bytes.Buffer) error {
+	var err error
+
+	// Size of the extension (always 22)
+	err = binary.Write(buffer, binary.LittleEndian, uint16(22))
+	if err != nil {
+		return err
+	}
+
+	// Valid bits per sample
+	err = binary.Write(buffer, binary.LittleEndian, w.description.validBits())
+	if err != nil {
+		return err
+	}
+
+	// Channel mask (0 = no speaker assignments)
+	err = binary.Write(buffer, binary.LittleEndian, uint32(0))
+	if err != nil {
+		return err
+	}
+
+	// Sub format (KSDATAFORMAT_SUBTYPE_PCM or KSDATAFORMAT_SUBTYPE_IEEE_FLOAT,
+	// or their ambisonic B-format equivalents)
+	if w.Ambisonic {
+		guid := append([]byte(nil), subFormatAmbisonic...)
+		if w.description.isFloat() {
+			guid[0] = 0x03
+		}
+		_, err = buffer.Write(guid)
+		return err
+	}
+
+	if w.description.isFloat() {
+		_, err = buffer.Write(subFormatIEEEFloat)
+		return err
+	}
+
+	_, err = buffer.Write(subFormatPCM)
+	return err
+}
+
+// extendedFmt returns whether the fmt chunk uses the 18-byte form.  It's
+// always used for IEEE float data, which requires the cbSize field.
+func (w *WaveFile) extendedFmt() bool {
+	return w.ExtendedFmt || w.description.isFloat()
+}
+
+// extensible returns whether the fmt chunk must use the extensible form,
+// which is the case when samples have fewer valid bits than their container
+// or the file is ambisonic.
+func (w *WaveFile) extensible() bool {
+	return w.Ambisonic || w.description.validBits() < w.description.containerBits()
+}
+
+// writeChunk writes a complete chunk with the given ID and body to the
+// buffer, followed by a pad byte if the body has an odd length.
+func (w *WaveFile) writeChunk(buffer *bytes.Buffer, id string, body []byte) error {
+	var err error
+
+	buffer.WriteString(id)
+
+	err = binary.Write(buffer, binary.LittleEndian, uint32(len(body)))
+	if err != nil {
+		return err
+	}
+
+	buffer.Write(body)
+	if len(body)%2 == 1 {
+		buffer.WriteByte(0)
+	}
+
+	return nil
+}
+
+// writeJunkChunk writes a JUNK chunk to the buffer that pads the headers so
+// that the samples, which follow the 8-byte data chunk header, start at a
+// multiple of DataAlignment.
+func (w *WaveFile) writeJunkChunk(buffer *bytes.Buffer) error {
+	align := int(w.DataAlignment)
+	pad := (align - (buffer.Len()+8)%align) % align
+	if pad == 0 {
+		return nil
+	}
+
+	// The JUNK chunk needs room for its own header.
+	for pad < 8 {
+		pad += align
+	}
+
+	return w.writeChunk(buffer, "JUNK", make([]byte, pad-8))
+}
+
+// startDataChunk writes the start of the data chunk to the buffer.
+func (w *WaveFile) startDataChunk(buffer *bytes.Buffer) error {
+	var err error
+
+	// Chunk ID (data)
+	_, err = buffer.WriteString("data")
+	if err != nil {
+		return err
+	}
+
+	// Chunk size (unknown at this time)
+	err = binary.Write(buffer, binary.LittleEndian, w.unknownSize())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writeTrailingChunks writes the cue points and the chunks from SetChunks
+// that follow the data chunk, preceded by the data chunk's pad byte, and
+// updates the size of the RIFF chunk to include them.
+func (w *WaveFile) writeTrailingChunks() error {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	if w.bytesWritten%2 == 1 {
+		buffer.WriteByte(0)
+	}
+	padding := buffer.Len()
+
+	if len(w.cues) != 0 {
+		cue, adtl, err := encodeWaveCues(w.cues)
+		if err != nil {
+			return err
+		}
+
+		err = w.writeChunk(buffer, "cue ", cue)
+		if err != nil {
+			return err
+		}
+
+		if adtl != nil {
+			err = w.writeChunk(buffer, "LIST", adtl)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The header already holds every chunk if the sizes aren't patched.
+	for _, chunk := range w.chunks {
+		if chunk.AfterData && w.patchesSizes() {
+			err = w.writeChunk(buffer, chunk.ID, chunk.Body)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if buffer.Len() == padding {
+		return nil
+	}
+
+	n, err := w.writer().Write(buffer.Bytes())
+	w.trailerSize = uint32(n)
+	if err != nil {
+		return err
+	}
+
+	return w.closeRIFFChunk()
+}
+
+// writeData writes bytes to the data chunk, keeping count of them, adding them
+// to the checksum and copying them to the monitor.
+func (w *WaveFile) writeData(data []byte) error {
+	// Streaming files leave their sizes unknown, so they have no limit.
+	if !w.streaming() && int64(w.headerSize)+int64(w.bytesWritten)+int64(len(data)) > MaxFileSize(FormatWave) {
+		return errors.New("The data would exceed the maximum size of a .wav file.")
+	}
+
+	n, err := w.writer().Write(data)
+	w.bytesWritten += uint32(n)
+
+	if w.Checksum != nil {
+		w.Checksum.Write(data[:n])
+	}
+
+	if w.monitor != nil {
+		w.monitor.Write(data[:n])
+	}
+
+	err = shortWrite(n, len(data), err)
+	if err != nil {
+		return err
+	}
+
+	if w.UpdateInterval != 0 && w.patchesSizes() && w.bytesWritten-w.lastUpdate >= w.UpdateInterval {
+		return w.updateSizes()
+	}
+
+	return nil
+}
+
+// updateSizes patches the chunk sizes in the header to match the data written
+// so far.  Only WriteAt is used, so the write position isn't disturbed.
+func (w *WaveFile) updateSizes() error {
+	var err error
+
+	err = w.countAppended()
+	if err != nil {
+		return err
+	}
+	w.lastUpdate = w.bytesWritten
+
+	err = w.closeDataChunk()
+	if err != nil {
+		return err
+	}
+
+	err = w.closeFactChunk()
+	if err != nil {
+		return err
+	}
+
+	return w.closeRIFFChunk()
+}
+
+// padDataChunk writes silence until the size of the data chunk is a multiple
+// of PadToBlock.
+func (w *WaveFile) padDataChunk() error {
+	var err error
+
+	if w.PadToBlock == 0 || w.bytesWritten%w.PadToBlock == 0 {
+		return nil
+	}
+
+	// Encode a single frame of silence and repeat it.
+	frame := new(bytes.Buffer)
+	for i := 0; i < int(w.description.NumChannels); i++ {
+		err = w.writeFloatToBuffer(0, frame)
+		if err != nil {
+			return err
+		}
+	}
+
+	padding := w.PadToBlock - w.bytesWritten%w.PadToBlock
+	silence := bytes.Repeat(frame.Bytes(), int(padding)/frame.Len())
+
+	return w.writeData(silence)
+}
+
+// fillSizes writes the final chunk sizes and frame count for dataSize bytes of
+// data into a header built by writeHeader.
+func (w *WaveFile) fillSizes(header []byte, dataSize uint32) {
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(header))-8+dataSize)
+	binary.LittleEndian.PutUint32(header[len(header)-4:], dataSize)
+
+	if w.factOffset != 0 {
+		var numFrames uint32
+		if w.frameSize() > 0 {
+			numFrames = dataSize / w.frameSize()
+		}
+		binary.LittleEndian.PutUint32(header[w.factOffset:], numFrames)
+	}
+}
+
+// knownDataSize returns the size of the data chunk for the frame count given
+// to OpenWithFrameCount, including any padding to PadToBlock.
+func (w *WaveFile) knownDataSize() uint64 {
+	size := w.frameCount * uint64(w.frameSize())
+	if w.PadToBlock != 0 && size%uint64(w.PadToBlock) != 0 {
+		size += uint64(w.PadToBlock) - size%uint64(w.PadToBlock)
+	}
+	return size
+}
+
+// checkFrameCount returns an error if the file was opened with
+// OpenWithFrameCount and dataSize bytes don't hold the given number of
+// frames.
+func (w *WaveFile) checkFrameCount(dataSize uint32) error {
+	if !w.sizeKnown || uint64(dataSize) == w.frameCount*uint64(w.frameSize()) {
+		return nil
+	}
+
+	return fmt.Errorf("%d frames were written, but the header declares %d.", dataSize/w.frameSize(), w.frameCount)
+}
+
+// frameSize returns the number of bytes in a single muxed frame.
+func (w *WaveFile) frameSize() uint32 {
+	return uint32(w.description.NumChannels) * uint32(w.description.containerBits()) / 8
+}
+
+// unknownSize returns the placeholder written for chunk sizes that aren't
+// known until the file is closed.
+func (w *WaveFile) unknownSize() uint32 {
+	if w.streaming() {
+		return 0xFFFFFFFF
+	}
+	return 0
+}
+
+// closeDataChunk writes the size of the data chunk to its header.
+func (w *WaveFile) closeDataChunk() error {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	err = binary.Write(buffer, binary.LittleEndian, w.bytesWritten)
+	if err != nil {
+		return err
+	}
+
+	// The size of the data chunk is the last field of the header.
+	_, err = w.headerFile().WriteAt(buffer.Bytes(), int64(w.headerSize)-4)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// closeFactChunk writes the number of frames to the fact chunk, if there is
+// one.
+func (w *WaveFile) closeFactChunk() error {
+	var err error
+
+	if w.factOffset == 0 {
+		return nil
+	}
+
+	var numFrames uint32
+	if w.frameSize() > 0 {
+		numFrames = w.bytesWritten / w.frameSize()
+	}
+
+	buffer := new(bytes.Buffer)
+	err = binary.Write(buffer, binary.LittleEndian, numFrames)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.headerFile().WriteAt(buffer.Bytes(), int64(w.factOffset))
+	return err
+}
+
+// closeRIFFChunk writes the size of the RIFF chunk to its header.
+func (w *WaveFile) closeRIFFChunk() error {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	err = binary.Write(buffer, binary.LittleEndian, w.bytesWritten+w.headerSize-8+w.trailerSize)
+	if err != nil {
+		return err
+	}
+
+	// The offset of the size of the RIFF chunk is always 4 bytes.
+	_, err = w.headerFile().WriteAt(buffer.Bytes(), 4)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writeLoudness patches the measured loudness into the bext chunk, making it a
+// version 2 chunk.  Nothing is written if the loudness wasn't measured, the
+// file is silent or the header can't be patched.
+func (w *WaveFile) writeLoudness() error {
+	var err error
+
+	if !w.MeasureLoudness || w.bextOffset == 0 || w.streaming() {
+		return nil
+	}
+
+	loudness := w.loudness.integrated()
+	if math.IsInf(loudness, -1) {
+		return nil
+	}
+	loudness = math.Max(-327.67, math.Min(327.67, loudness))
+
+	buffer := new(bytes.Buffer)
+	err = binary.Write(buffer, binary.LittleEndian, int16(math.Round(loudness*100)))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.headerFile().WriteAt(buffer.Bytes(), int64(w.bextOffset)+bextLoudnessOffset)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.headerFile().WriteAt([]byte{2, 0}, int64(w.bextOffset)+bextVersionOffset)
+	return err
+}
+
+// clearSizes sets the RIFF and data chunk sizes in the header back to
+// unknown.
+func (w *WaveFile) clearSizes() error {
+	var err error
+
+	buffer := new(bytes.Buffer)
+	err = binary.Write(buffer, binary.LittleEndian, w.unknownSize())
+	if err != nil {
+		return err
+	}
+
+	for _, offset := range []int64{4, int64(w.headerSize) - 4} {
+		_, err = w.headerFile().WriteAt(buffer.Bytes(), offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resampling returns whether the data is resampled when the file is closed.
+func (w *WaveFile) resampling() bool {
+	return w.TargetSampleRate != 0 && w.TargetSampleRate != w.description.SampleRate
+}
+
+// outputSampleRate returns the sample rate written to the file.
+func (w *WaveFile) outputSampleRate() uint32 {
+	if w.TargetSampleRate != 0 {
+		return w.TargetSampleRate
+	}
+	return w.description.SampleRate
+}
+
+// outputRate is like outputSampleRate, but it keeps the exact rate of the
+// description if the file isn't resampled.
+func (w *WaveFile) outputRate() float64 {
+	if w.resampling() {
+		return float64(w.TargetSampleRate)
+	}
+	return w.description.sampleRate()
+}
+
+// outputLoops returns the loops with their frames scaled to the output sample
+// rate.
+func (w *WaveFile) outputLoops() []SampleLoop {
+	if !w.resampling() {
+		return w.loops
+	}
+
+	ratio := float64(w.TargetSampleRate) / w.description.sampleRate()
+	loops := make([]SampleLoop, len(w.loops))
+	for i, loop := range w.loops {
+		loop.Start = uint32(math.Round(float64(loop.Start) * ratio))
+		loop.End = uint32(math.Round(float64(loop.End) * ratio))
+		loops[i] = loop
+	}
+
+	return loops
+}
+
+// buffering returns whether the channels are buffered until the file is
+// closed, to be resampled or limited.
+func (w *WaveFile) buffering() bool {
+	return w.resampling() || w.Limiter != nil
+}
+
+// flushPending resamples and limits the buffered channels as needed and writes
+// them to the file in blocks.
+func (w *WaveFile) flushPending() error {
+	var err error
+
+	var channels [][]float64
+	if w.resampling() {
+		channels = w.pending.resample(w.description.SampleRate, w.TargetSampleRate)
+	} else {
+		channels = w.pending.take()
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+
+	if w.Limiter != nil {
+		w.Limiter.Apply(channels, w.outputSampleRate())
+	}
+
+	buffer := new(bytes.Buffer)
+	for start := 0; start < len(channels[0]); start += silenceBlockSize {
+		end := start + silenceBlockSize
+		if end > len(channels[0]) {
+			end = len(channels[0])
+		}
+
+		buffer.Reset()
+		for i := start; i < end; i++ {
+			for j := range channels {
+				err = w.writeSampleToBuffer(channels[j][i], j, i-start, buffer)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = w.writeData(buffer.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSidecar writes the JSON sidecar describing the closed file.
+func (w *WaveFile) writeSidecar() error {
+	desc := w.description
+	if w.TargetSampleRate != 0 {
+		desc = NewAudioDescription(desc.NumChannels, float64(w.TargetSampleRate), desc.BitsPerSample)
+		desc.ContainerBits = w.description.ContainerBits
+		desc.Format = w.description.Format
+	}
+
+	var frames uint64
+	if w.frameSize() > 0 {
+		frames = uint64(w.bytesWritten / w.frameSize())
+	}
+
+	return writeSidecar(w.name, desc, frames, &w.levels)
+}
+
+// inspectsSamples returns whether any option needs to see each sample given
+// as a float, which rules out the fast path for 16-bit stereo.
+func (w *WaveFile) inspectsSamples() bool {
+	return w.gains != nil || w.ReferenceScale != 0 || w.StrictClip || w.WriteSidecar ||
+		w.OverviewBinSize != 0 || w.MeasureLoudness || w.Dither != DitherNone
+}
+
+// gain returns the gain of the given channel.
+func (w *WaveFile) gain(channel int) float64 {
+	if w.gains == nil {
+		return 1
+	}
+	return w.gains[channel]
+}
+
+// writeSampleToBuffer applies the channel gain and reference scale to a sample
+// and writes it to the buffer, checking for clipping if StrictClip is set.
+// frame is the index of the sample's frame relative to the frames already in
+// the file.
+func (w *WaveFile) writeSampleToBuffer(data float64, channel, frame int, buffer *bytes.Buffer) error {
+	data *= w.gain(channel)
+	if w.ReferenceScale != 0 {
+		data *= w.ReferenceScale
+	}
+
+	if w.StrictClip && !(math.Abs(data) <= 1) {
+		var written uint64
+		if w.frameSize() > 0 {
+			written = uint64(w.bytesWritten / w.frameSize())
+		}
+		return &ClipError{Channel: channel, Frame: written + uint64(frame), Value: data}
+	}
+
+	w.overview.add(data, channel)
+	w.loudness.add(data, channel)
+	if w.WriteSidecar {
+		w.levels.add(data)
+	}
+
+	if w.dither != nil {
+		data = w.dither.process(data, channel)
+	}
+	return w.writeFloatToBuffer(data, buffer)
+}
+
+// writeFloatToBuffer writes the sample to the buffer at the right bit depth.
+func (w *WaveFile) writeFloatToBuffer(data float64, buffer *bytes.Buffer) error {
+	return encodeSample(data, w.description, binary.LittleEndian, w.Signed8Bit, buffer)
 }
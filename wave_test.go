@@ -0,0 +1,445 @@
+package audioExport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestWave writes the channels to a new .wav file in a temporary
+// directory and returns its name.
+func writeTestWave(t *testing.T, w *WaveFile, description AudioDescription, channels ...[]float64) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), "out.wav")
+	err := w.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteChannels(channels...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fileName
+}
+
+func TestWaveFileOpenAppendClearsOffsets(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 48000, BitsPerSample: 16}
+	target := writeTestWave(t, &WaveFile{}, description, []float64{0, 0.25})
+
+	before, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first file records where its bext chunk is, which must not be
+	// patched into the file that's appended to afterwards.
+	w := WaveFile{MeasureLoudness: true}
+	err = w.SetBroadcastExtension(&BroadcastExtension{Description: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestWave(t, &w, description, []float64{0.5, -0.5})
+
+	err = w.OpenAppend(target, AudioDescription{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loudness is only measured over at least 400ms of audio.
+	appended := make([]float64, 24000)
+	for i := range appended {
+		appended[i] = 0.5 - float64(i%2)
+	}
+
+	err = w.WriteChannels(appended)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the sizes and the new frame may differ.
+	if len(after) != len(before)+2*len(appended) {
+		t.Fatalf("the file is %d bytes, want %d", len(after), len(before)+2*len(appended))
+	}
+	if !bytes.Equal(after[8:len(before)-8], before[8:len(before)-8]) {
+		t.Error("OpenAppend changed the headers of the file")
+	}
+
+	data, err := ReadWaveFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Channels[0]) != 2+len(appended) {
+		t.Fatalf("got %d frames, want %d", len(data.Channels[0]), 2+len(appended))
+	}
+	for i, want := range appended {
+		if got := data.Channels[0][2+i]; math.Abs(got-want) > 1.0/32767 {
+			t.Fatalf("frame %d is %v, want %v", 2+i, got, want)
+		}
+	}
+}
+
+func TestWaveFileOpenAppendClosesFileOnError(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 48000, BitsPerSample: 16}
+	target := writeTestWave(t, &WaveFile{}, description, []float64{0})
+
+	w := WaveFile{Dither: -1}
+	err := w.OpenAppend(target, AudioDescription{})
+	if err == nil {
+		t.Fatal("OpenAppend succeeded with an invalid dither mode")
+	}
+
+	err = w.WriteBytes([]byte{0, 0})
+	if err != ErrClosed {
+		t.Errorf("WriteBytes after a failed OpenAppend returned %v, want ErrClosed", err)
+	}
+}
+
+func TestWaveFileWriteChannelsInt32ChecksChannels(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 24}
+
+	var w WaveFile
+	err := w.Open(filepath.Join(t.TempDir(), "out.wav"), description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	err = w.WriteChannelsInt32([]int32{0})
+	if !errors.Is(err, ErrChannelCountMismatch) {
+		t.Errorf("one channel returned %v, want ErrChannelCountMismatch", err)
+	}
+
+	err = w.WriteChannelsInt32([]int32{0, 1}, []int32{0})
+	if err == nil {
+		t.Error("channels of different lengths were accepted")
+	}
+
+	err = w.WriteChannelsInt32([]int32{0, 1}, []int32{2, 3})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWaveFileOpenRejectsNoChannels(t *testing.T) {
+	for _, channels := range []int16{0, -1} {
+		description := AudioDescription{NumChannels: channels, SampleRate: 48000, BitsPerSample: 16}
+
+		var w WaveFile
+		err := w.Open(filepath.Join(t.TempDir(), "out.wav"), description)
+		if err == nil {
+			w.Close()
+			t.Errorf("Open succeeded with %d channels", channels)
+		}
+	}
+}
+
+func TestWaveFilePreallocate(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 24}
+	fileName := filepath.Join(t.TempDir(), "out.wav")
+
+	var w WaveFile
+	err := w.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	err = w.WriteChannels([]float64{0, 0}, []float64{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Preallocate(1)
+	if err == nil {
+		t.Error("Preallocate accepted fewer frames than were written")
+	}
+
+	err = w.Preallocate(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := EstimateFileSize(FormatWave, description, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != want {
+		t.Errorf("the preallocated file is %d bytes, want %d", info.Size(), want)
+	}
+}
+
+func FuzzReadWaveFile(f *testing.F) {
+	descriptions := []AudioDescription{
+		{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16},
+		{NumChannels: 1, SampleRate: 48000, BitsPerSample: 8},
+		{NumChannels: 6, SampleRate: 48000, BitsPerSample: 24},
+		{NumChannels: 2, SampleRate: 48000, BitsPerSample: 32, Format: FormatIEEEFloat},
+	}
+
+	for _, description := range descriptions {
+		// Four frames of silence.
+		data := make([]byte, 4*int(description.NumChannels)*int(description.containerBits())/8)
+
+		header, err := WaveHeader(description, uint32(len(data)))
+		if err != nil {
+			f.Fatal(err)
+		}
+		valid := append(header, data...)
+
+		// The valid file, then its headers cut short at a few places.
+		f.Add(valid)
+		for _, length := range []int{0, 4, 12, 20, 36, len(header) - 1, len(header)} {
+			f.Add(valid[:length])
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, contents []byte) {
+		fileName := filepath.Join(t.TempDir(), "fuzz.wav")
+		err := os.WriteFile(fileName, contents, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ReadWaveFile(fileName)
+		if err != nil {
+			return
+		}
+
+		// A file that decodes must have a consistent set of channels.
+		if len(data.Channels) != int(data.Description.NumChannels) {
+			t.Fatalf("got %d channels, but the description has %d", len(data.Channels), data.Description.NumChannels)
+		}
+		for _, channel := range data.Channels {
+			if len(channel) != len(data.Channels[0]) {
+				t.Fatal("the channels have different lengths")
+			}
+		}
+	})
+}
+
+func TestWaveFileWriteEmptyChannels(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16}
+	fileName := filepath.Join(t.TempDir(), "out.wav")
+
+	var w WaveFile
+	err := w.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteChannels([]float64{}, []float64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteChannels([]float64{0.5}, []float64{-0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteChannels(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadWaveFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Channels[0]) != 1 {
+		t.Errorf("got %d frames, want 1", len(data.Channels[0]))
+	}
+}
+
+func TestWaveFileWriteOnlyEmptyChannels(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 24}
+	fileName := writeTestWave(t, &WaveFile{}, description, []float64{})
+
+	data, err := ReadWaveFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Channels) != 1 || len(data.Channels[0]) != 0 {
+		t.Errorf("got %d channels, want 1 empty channel", len(data.Channels))
+	}
+}
+
+func BenchmarkWriteStereo16(b *testing.B) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 44100, BitsPerSample: 16}
+
+	left := make([]float64, 4096)
+	right := make([]float64, 4096)
+	for i := range left {
+		left[i] = float64(i%200)/100 - 1
+		right[i] = -left[i]
+	}
+
+	var w WaveFile
+	err := w.Open(filepath.Join(b.TempDir(), "out.wav"), description)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer w.Close()
+
+	b.SetBytes(int64(len(left)) * 4)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err = w.WriteChannels(left, right)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWaveFileOpenAppendEmptyDataWithTrailingChunks(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 48000, BitsPerSample: 16}
+	fileName := filepath.Join(t.TempDir(), "out.wav")
+
+	var w WaveFile
+	err := w.Open(fileName, description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.AddCue(0, "start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cue chunks follow an empty data chunk, so the data chunk isn't the
+	// last chunk and the file can't be appended to.
+	var appender WaveFile
+	err = appender.OpenAppend(fileName, AudioDescription{})
+	if err == nil {
+		appender.Close()
+		t.Fatal("OpenAppend took the chunks after an empty data chunk for samples")
+	}
+
+	after, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("the failed OpenAppend changed the file")
+	}
+}
+
+func TestWaveFileOpenAppendDeferredSizes(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 16}
+	fileName := writeTestWave(t, &WaveFile{DeferSizes: true}, description, []float64{0, 0.5}, []float64{0, -0.5})
+
+	w := WaveFile{DeferSizes: true}
+	err := w.OpenAppend(fileName, AudioDescription{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteChannels([]float64{1}, []float64{-1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadWaveFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Channels[0]) != 3 {
+		t.Errorf("got %d frames, want 3", len(data.Channels[0]))
+	}
+}
+
+func TestWaveFileCloseFlushError(t *testing.T) {
+	description := AudioDescription{NumChannels: 1, SampleRate: 44100, BitsPerSample: 16}
+
+	w := WaveFile{TargetSampleRate: 48000, StrictClip: true}
+	err := w.Open(filepath.Join(t.TempDir(), "out.wav"), description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteChannels([]float64{0, 1.5, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Close()
+	var clipErr *ClipError
+	if !errors.As(err, &clipErr) {
+		t.Fatalf("Close returned %v, want a *ClipError", err)
+	}
+
+	if err := w.file.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("the file is still open after Close failed: %v", err)
+	}
+	if err := w.Close(); err != ErrClosed {
+		t.Errorf("a second Close returned %v, want ErrClosed", err)
+	}
+}
+
+func TestWaveFileSidecarLevels(t *testing.T) {
+	// The levels describe the samples that were given, so neither the dither
+	// nor the padding after them should change the peak or RMS.
+	description := AudioDescription{NumChannels: 1, SampleRate: 48000, BitsPerSample: 8}
+	w := WaveFile{WriteSidecar: true, Dither: DitherTPDF, PadToBlock: 4}
+	fileName := writeTestWave(t, &w, description, []float64{0.5, -0.5})
+
+	data, err := os.ReadFile(fileName + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info SidecarInfo
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Peak != 0.5 || info.RMS != 0.5 || info.Clips != 0 {
+		t.Errorf("got peak %v, RMS %v and %d clips, want 0.5, 0.5 and 0", info.Peak, info.RMS, info.Clips)
+	}
+}
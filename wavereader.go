@@ -0,0 +1,513 @@
+package audioExport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"iter"
+	"os"
+)
+
+// WaveData holds the contents of a decoded .wav file.
+type WaveData struct {
+	Description AudioDescription
+	Channels    [][]float64
+	Info        WaveInfo
+
+	// Chunks holds every chunk other than fmt, fact, data and JUNK padding,
+	// in the order they appear, so that they can be given back to
+	// WaveFile.SetChunks when the file is exported again.
+	Chunks []Chunk
+}
+
+// Chunk is a RIFF chunk kept verbatim, such as one this package doesn't
+// understand.
+type Chunk struct {
+	ID        string // The 4-character chunk ID
+	Body      []byte // The body, without the chunk header or pad byte
+	AfterData bool   // Whether the chunk followed the data chunk
+}
+
+// WaveInfo holds the metadata found in the LIST/INFO chunk of a .wav file.
+// Subchunks without a dedicated field are kept in Other, keyed by their
+// 4-character ID.
+type WaveInfo struct {
+	Title     string // INAM
+	Artist    string // IART
+	Album     string // IPRD
+	Comment   string // ICMT
+	Date      string // ICRD
+	Genre     string // IGNR
+	Copyright string // ICOP
+	Software  string // ISFT
+	Engineer  string // IENG
+	Track     string // ITRK
+	Other     map[string]string
+}
+
+// ReadWaveFile decodes the .wav file with the given name.  The samples of
+// each channel are converted to float64 values ranging from -1 to 1.
+func ReadWaveFile(fileName string) (*WaveData, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return readWave(file, info.Size())
+}
+
+// readAheadSize is the size of the buffer WaveReader reads the data through.
+const readAheadSize = 64 * 1024
+
+// WaveReader decodes a .wav file incrementally, one frame at a time, so that
+// large files don't have to be held in memory.
+type WaveReader struct {
+	file        *os.File
+	description AudioDescription
+	info        WaveInfo
+	order       binary.ByteOrder
+	data        *bufio.Reader
+	remaining   int64
+	frame       []byte
+}
+
+// OpenWaveReader opens the .wav file with the given name and reads its
+// headers up to the start of the data chunk.  The corresponding Close method
+// should always be called when you're done reading.
+func OpenWaveReader(fileName string) (*WaveReader, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &WaveReader{file: file}
+	err = r.readHeader()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// AudioDescription returns the format of the file.
+func (r *WaveReader) AudioDescription() AudioDescription {
+	return r.description
+}
+
+// Info returns the LIST/INFO metadata read while locating the data chunk,
+// which doesn't include any that follows both the fmt and data chunks.
+func (r *WaveReader) Info() WaveInfo {
+	return r.info
+}
+
+// ReadFrame decodes the next frame, returning one sample per channel ranging
+// from -1 to 1.  It returns io.EOF once every frame has been read.
+func (r *WaveReader) ReadFrame() ([]float64, error) {
+	if r.remaining < int64(len(r.frame)) {
+		return nil, io.EOF
+	}
+
+	_, err := io.ReadFull(r.data, r.frame)
+	if err == io.EOF {
+		// The data chunk is shorter than its declared size.
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.remaining -= int64(len(r.frame))
+
+	sampleSize := int(r.description.containerBits()) / 8
+	frame := make([]float64, r.description.NumChannels)
+	for i := range frame {
+		if r.description.isFloat() {
+			frame[i] = decodeFloatSample(r.frame[i*sampleSize:], r.description.containerBits(), r.order)
+		} else {
+			frame[i] = decodeSample(r.frame[i*sampleSize:], r.description.containerBits(), r.order, false)
+		}
+	}
+
+	return frame, nil
+}
+
+// Frames returns an iterator over the remaining frames, for use with range:
+//
+//	for frame, err := range reader.Frames() {
+//		...
+//	}
+//
+// Iteration stops after the last frame or after the first error is yielded.
+func (r *WaveReader) Frames() iter.Seq2[[]float64, error] {
+	return func(yield func([]float64, error) bool) {
+		for {
+			frame, err := r.ReadFrame()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(frame, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Close closes the file.
+func (r *WaveReader) Close() error {
+	return r.file.Close()
+}
+
+/*****************************************************************************/
+/**************************** Private Functions ******************************/
+/*****************************************************************************/
+
+// readWave decodes a .wav stream of the given size, which is -1 if unknown.
+func readWave(r io.Reader, fileSize int64) (*WaveData, error) {
+	var err error
+
+	header := make([]byte, 12)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The number of bytes left in the file, if it's known, is used to reject
+	// chunk sizes that can't be right.
+	remaining := int64(-1)
+	if fileSize >= 0 {
+		remaining = fileSize - 12
+	}
+
+	// RIFF files are little-endian and RIFX files are big-endian.
+	var order binary.ByteOrder
+	switch string(header[0:4]) {
+	case "RIFF":
+		order = binary.LittleEndian
+	case "RIFX":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("Unrecognized file magic; expected RIFF or RIFX.")
+	}
+
+	if string(header[8:12]) != "WAVE" {
+		return nil, errors.New("The file is not a WAVE file.")
+	}
+
+	data := new(WaveData)
+	haveFmt := false
+	var samples []byte
+	haveData := false
+
+	for {
+		id, chunkSize, err := readChunkHeader(r, order)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		remaining -= 8
+		body, err := readChunkBody(r, chunkSize, remaining)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= int64(chunkSize)
+
+		switch id {
+		case "fmt ":
+			data.Description, err = parseFmtChunk(body, order)
+			if err != nil {
+				return nil, err
+			}
+			haveFmt = true
+		case "data":
+			// The samples are decoded once every chunk has been read, since
+			// some encoders put the fmt chunk after the data chunk.
+			samples = body
+			haveData = true
+		case "LIST":
+			if len(body) >= 4 && string(body[0:4]) == "INFO" {
+				data.Info = parseInfoList(body[4:], order)
+			}
+		}
+
+		if preservedChunk(id) {
+			data.Chunks = append(data.Chunks, Chunk{ID: id, Body: body, AfterData: haveData})
+		}
+
+		// Chunks are padded to an even number of bytes.
+		if chunkSize%2 == 1 {
+			_, err = io.ReadFull(r, make([]byte, 1))
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			remaining--
+		}
+	}
+
+	if !haveFmt {
+		return nil, errors.New("The file has no fmt chunk.")
+	}
+	if !haveData {
+		return nil, errors.New("The file has no data chunk.")
+	}
+
+	data.Channels = decodeSamples(samples, data.Description, order, false)
+	return data, nil
+}
+
+// preservedChunk returns whether a chunk is kept in WaveData.Chunks.  The
+// chunks that describe the samples or pad the headers are rebuilt by the
+// writer instead.
+func preservedChunk(id string) bool {
+	switch id {
+	case "fmt ", "fact", "data", "JUNK", "junk", "PAD ":
+		return false
+	default:
+		return true
+	}
+}
+
+// parseFmtChunk reads the audio description from the body of a fmt chunk.
+func parseFmtChunk(body []byte, order binary.ByteOrder) (AudioDescription, error) {
+	var desc AudioDescription
+
+	if len(body) < 16 {
+		return desc, errors.New("The fmt chunk is too short.")
+	}
+
+	desc.NumChannels = int16(order.Uint16(body[2:4]))
+	desc.SampleRate = order.Uint32(body[4:8])
+	desc.BitsPerSample = int16(order.Uint16(body[14:16]))
+
+	// The extensible form stores the real format in the first two bytes of
+	// its sub format GUID, along with the number of valid bits.
+	audioFormat := order.Uint16(body[0:2])
+	if audioFormat == 0xFFFE {
+		if len(body) < 40 {
+			return desc, errors.New("The extensible fmt chunk is too short.")
+		}
+
+		audioFormat = order.Uint16(body[24:26])
+		validBits := int16(order.Uint16(body[18:20]))
+		if validBits > 0 && validBits < desc.BitsPerSample {
+			desc.ContainerBits = desc.BitsPerSample
+			desc.BitsPerSample = validBits
+		}
+	}
+
+	switch audioFormat {
+	case 1:
+		desc.Format = FormatPCM
+	case 3:
+		desc.Format = FormatIEEEFloat
+	default:
+		return desc, errors.New("Only uncompressed PCM and IEEE float data are supported.")
+	}
+
+	if desc.NumChannels <= 0 {
+		return desc, errors.New("The fmt chunk has an invalid number of channels.")
+	}
+
+	switch {
+	case desc.isFloat() && (desc.containerBits() == BPS32 || desc.containerBits() == BPS64):
+	case desc.isFloat():
+		return desc, errors.New("Invalid bit depth.")
+	case desc.containerBits() == BPS8, desc.containerBits() == BPS16,
+		desc.containerBits() == BPS24, desc.containerBits() == BPS32:
+	default:
+		return desc, errors.New("Invalid bit depth.")
+	}
+
+	return desc, nil
+}
+
+// parseInfoList reads the subchunks of a LIST/INFO chunk.
+func parseInfoList(body []byte, order binary.ByteOrder) WaveInfo {
+	var info WaveInfo
+
+	for len(body) >= 8 {
+		id := string(body[0:4])
+		size := int(order.Uint32(body[4:8]))
+		body = body[8:]
+		if size > len(body) {
+			size = len(body)
+		}
+
+		value := string(bytes.TrimRight(body[:size], "\x00"))
+
+		switch id {
+		case "INAM":
+			info.Title = value
+		case "IART":
+			info.Artist = value
+		case "IPRD":
+			info.Album = value
+		case "ICMT":
+			info.Comment = value
+		case "ICRD":
+			info.Date = value
+		case "IGNR":
+			info.Genre = value
+		case "ICOP":
+			info.Copyright = value
+		case "ISFT":
+			info.Software = value
+		case "IENG":
+			info.Engineer = value
+		case "ITRK":
+			info.Track = value
+		default:
+			if info.Other == nil {
+				info.Other = make(map[string]string)
+			}
+			info.Other[id] = value
+		}
+
+		// Subchunks are padded to an even number of bytes.
+		size += size % 2
+		if size > len(body) {
+			size = len(body)
+		}
+		body = body[size:]
+	}
+
+	return info
+}
+
+// readHeader reads the chunks up to the start of the data chunk.
+func (r *WaveReader) readHeader() error {
+	var err error
+
+	stat, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 12)
+	_, err = io.ReadFull(r.file, header)
+	if err != nil {
+		return err
+	}
+
+	switch string(header[0:4]) {
+	case "RIFF":
+		r.order = binary.LittleEndian
+	case "RIFX":
+		r.order = binary.BigEndian
+	default:
+		return errors.New("Unrecognized file magic; expected RIFF or RIFX.")
+	}
+
+	if string(header[8:12]) != "WAVE" {
+		return errors.New("The file is not a WAVE file.")
+	}
+
+	remaining := stat.Size() - 12
+	haveFmt := false
+
+	// If the data chunk comes before the fmt chunk, its position is
+	// remembered so that reading can return to it once the fmt chunk is found.
+	dataStart := int64(-1)
+
+	for {
+		id, size, err := readChunkHeader(r.file, r.order)
+		if err == io.EOF {
+			if dataStart >= 0 {
+				return errors.New("The file has no fmt chunk.")
+			}
+			return errors.New("The file has no data chunk.")
+		}
+		if err != nil {
+			return err
+		}
+		remaining -= 8
+
+		if id == "data" {
+			// The data can't extend past the end of the file, which also
+			// covers streamed files whose size is 0xFFFFFFFF.
+			r.remaining = int64(size)
+			if r.remaining > remaining {
+				r.remaining = remaining
+			}
+
+			if haveFmt {
+				return r.startData()
+			}
+
+			dataStart, err = r.file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+
+			skip := r.remaining + r.remaining%2
+			if skip > remaining {
+				skip = remaining
+			}
+			_, err = r.file.Seek(skip, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			remaining -= skip
+			continue
+		}
+
+		body, err := readChunkBody(r.file, size, remaining)
+		if err != nil {
+			return err
+		}
+		remaining -= int64(size)
+
+		switch id {
+		case "fmt ":
+			r.description, err = parseFmtChunk(body, r.order)
+			if err != nil {
+				return err
+			}
+			haveFmt = true
+
+			if dataStart >= 0 {
+				_, err = r.file.Seek(dataStart, io.SeekStart)
+				if err != nil {
+					return err
+				}
+				return r.startData()
+			}
+		case "LIST":
+			if len(body) >= 4 && string(body[0:4]) == "INFO" {
+				r.info = parseInfoList(body[4:], r.order)
+			}
+		}
+
+		// Chunks are padded to an even number of bytes.
+		if size%2 == 1 {
+			_, err = io.ReadFull(r.file, make([]byte, 1))
+			if err != nil {
+				return err
+			}
+			remaining--
+		}
+	}
+}
+
+// startData prepares to read frames from the current position, which is the
+// start of the data chunk.  The data is read ahead through a buffer so that
+// reading a frame doesn't take a system call.
+func (r *WaveReader) startData() error {
+	r.frame = make([]byte, int(r.description.NumChannels)*int(r.description.containerBits())/8)
+	r.data = bufio.NewReaderSize(io.LimitReader(r.file, r.remaining), readAheadSize)
+	return nil
+}
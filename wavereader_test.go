@@ -0,0 +1,90 @@
+package audioExport
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestWaveReaderMatchesReadWaveFile(t *testing.T) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 16}
+
+	// More frames than fit in the read-ahead buffer.
+	channel := make([]float64, readAheadSize/2)
+	for i := range channel {
+		channel[i] = float64(i%200)/100 - 1
+	}
+	fileName := writeTestWave(t, &WaveFile{}, description, channel, channel)
+
+	data, err := ReadWaveFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenWaveReader(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := range channel {
+		frame, err := r.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if frame[0] != data.Channels[0][i] || frame[1] != data.Channels[1][i] {
+			t.Fatalf("frame %d is %v, want [%v %v]", i, frame, data.Channels[0][i], data.Channels[1][i])
+		}
+	}
+
+	_, err = r.ReadFrame()
+	if err != io.EOF {
+		t.Errorf("got %v after the last frame, want io.EOF", err)
+	}
+}
+
+func BenchmarkWaveReader(b *testing.B) {
+	description := AudioDescription{NumChannels: 2, SampleRate: 48000, BitsPerSample: 24}
+	fileName := filepath.Join(b.TempDir(), "in.wav")
+
+	channel := make([]float64, 48000)
+	for i := range channel {
+		channel[i] = float64(i%200)/100 - 1
+	}
+
+	var w WaveFile
+	err := w.Open(fileName, description)
+	if err != nil {
+		b.Fatal(err)
+	}
+	err = w.WriteChannels(channel, channel)
+	if err != nil {
+		b.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(channel)) * 6)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r, err := OpenWaveReader(fileName)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for {
+			_, err = r.ReadFrame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		r.Close()
+	}
+}